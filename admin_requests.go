@@ -0,0 +1,159 @@
+package redes_writer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// types of index administration requests, they are not bulk-able.
+var adminRequestTypes = []string{"create_index", "put_alias", "swap_alias", "refresh", "delete_index"}
+
+func (r Request) isAdmin() bool {
+	return contains(adminRequestTypes, r.Type)
+}
+
+// adminGuard rejects invalid requests which are executed outside of bulk,
+// and deleting indices or documents by query of indices which are not in the
+// allowlist.
+type adminGuard struct {
+	deletable []string // glob patterns
+}
+
+func (g adminGuard) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req && (req.isAdmin() || req.isByQuery()) {
+			if err := g.check(req); nil != err {
+				return reject(err)
+			}
+		}
+
+		return writer(req)
+	}
+}
+
+func (g adminGuard) check(req *Request) error {
+	switch req.Type {
+	case "create_index":
+		if "" == req.CreateIndex.Index {
+			return fmt.Errorf("create_index: missing index")
+		}
+
+	case "put_alias":
+		if "" == req.PutAlias.Index || "" == req.PutAlias.Alias {
+			return fmt.Errorf("put_alias: missing index or alias")
+		}
+
+	case "swap_alias":
+		if "" == req.SwapAlias.Alias || "" == req.SwapAlias.From || "" == req.SwapAlias.To {
+			return fmt.Errorf("swap_alias: missing alias, from or to")
+		}
+
+	case "refresh":
+		if "" == req.Refresh.Index {
+			return fmt.Errorf("refresh: missing index")
+		}
+
+	case "delete_index":
+		if "" == req.DeleteIndex.Index {
+			return fmt.Errorf("delete_index: missing index")
+		}
+
+		if !g.areDeletable(req.DeleteIndex.Index) {
+			return fmt.Errorf("delete_index: index %s is not allowed to be deleted", req.DeleteIndex.Index)
+		}
+
+	case "update_by_query", "delete_by_query":
+		byQuery := req.UpdateByQuery
+		if "delete_by_query" == req.Type {
+			byQuery = req.DeleteByQuery
+		}
+
+		if "" == byQuery.Index || nil == byQuery.Query {
+			return fmt.Errorf("%s: missing index or query", req.Type)
+		}
+
+		if "" != byQuery.Conflicts && "abort" != byQuery.Conflicts && "proceed" != byQuery.Conflicts {
+			return fmt.Errorf("%s: conflicts must be abort or proceed", req.Type)
+		}
+
+		if "delete_by_query" == req.Type && !g.areDeletable(byQuery.Index) {
+			return fmt.Errorf("delete_by_query: documents of index %s are not allowed to be deleted", byQuery.Index)
+		}
+	}
+
+	return nil
+}
+
+// areDeletable checks every index of comma separated list. Wildcards, _all &
+// exclusions are expanded by Elastic Search, they're only allowed when they're
+// in the allowlist as is.
+func (g adminGuard) areDeletable(indices string) bool {
+	for _, index := range strings.Split(indices, ",") {
+		if !g.isDeletable(strings.TrimSpace(index)) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (g adminGuard) isDeletable(index string) bool {
+	if "" == index {
+		return false
+	}
+
+	expanded := "_all" == index || strings.HasPrefix(index, "-") || strings.ContainsAny(index, "*?")
+	for _, pattern := range g.deletable {
+		if "" == pattern {
+			continue
+		}
+
+		if expanded && pattern == index {
+			return true
+		}
+
+		if !expanded && matchIndex(pattern, index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// executeAdmin runs index administration request on the cluster.
+func executeAdmin(ctx context.Context, client *elastic.Client, req *Request) error {
+	var err error
+
+	switch req.Type {
+	case "create_index":
+		service := client.CreateIndex(req.CreateIndex.Index)
+		if nil != req.CreateIndex.Body {
+			service.BodyJson(req.CreateIndex.Body)
+		}
+
+		_, err = service.Do(ctx)
+
+	case "put_alias":
+		_, err = client.Alias().Add(req.PutAlias.Index, req.PutAlias.Alias).Do(ctx)
+
+	case "swap_alias":
+		_, err = client.Alias().
+			Remove(req.SwapAlias.From, req.SwapAlias.Alias).
+			Add(req.SwapAlias.To, req.SwapAlias.Alias).
+			Do(ctx)
+
+	case "refresh":
+		_, err = client.Refresh(req.Refresh.Index).Do(ctx)
+
+	case "delete_index":
+		_, err = client.DeleteIndex(req.DeleteIndex.Index).Do(ctx)
+
+	default:
+		err = fmt.Errorf("invalid admin request type %s", req.Type)
+	}
+
+	return err
+}
@@ -0,0 +1,53 @@
+package redes_writer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminGuard(t *testing.T) {
+	guard := adminGuard{deletable: []string{"tmp-*"}}
+
+	cases := map[string]bool{
+		`{"type": "create_index", "create_index": {"index": "lr-v2", "body": {"settings": {"number_of_shards": 1}}}}`: true,
+		`{"type": "create_index", "create_index": {}}`:                                                                false,
+		`{"type": "swap_alias", "swap_alias": {"alias": "lr", "from": "lr-v1", "to": "lr-v2"}}`:                       true,
+		`{"type": "swap_alias", "swap_alias": {"alias": "lr", "to": "lr-v2"}}`:                                        false,
+		`{"type": "put_alias", "put_alias": {"index": "lr-v2", "alias": "lr"}}`:                                       true,
+		`{"type": "refresh", "refresh": {"index": "lr"}}`:                                                             true,
+		`{"type": "delete_index", "delete_index": {"index": "tmp-123"}}`:                                              true,
+		`{"type": "delete_index", "delete_index": {"index": "lr"}}`:                                                   false,
+		`{"type": "delete_by_query", "delete_by_query": {"index": "tmp-1,tmp-2", "query": {"match_all": {}}}}`:        true,
+		`{"type": "delete_by_query", "delete_by_query": {"index": "tmp-1,lr", "query": {"match_all": {}}}}`:           false,
+		`{"type": "update_by_query", "update_by_query": {"index": "lr", "query": {"match_all": {}}}}`:                 true,
+		`{"type": "delete_index", "delete_index": {"index": "tmp-1,tmp-2"}}`:                                          true,
+		`{"type": "delete_index", "delete_index": {"index": "tmp-1,lr"}}`:                                             false,
+		`{"type": "delete_index", "delete_index": {"index": "tmp-x,*"}}`:                                              false,
+		`{"type": "delete_index", "delete_index": {"index": "tmp-1*"}}`:                                               false,
+		`{"type": "delete_index", "delete_index": {"index": "_all"}}`:                                                 false,
+		`{"type": "delete_index", "delete_index": {"index": "tmp-1,"}}`:                                               false,
+		`{"type": "delete_by_query", "delete_by_query": {"index": "tmp-1,*", "query": {"match_all": {}}}}`:            false,
+	}
+
+	for raw, allowed := range cases {
+		req, _ := fromBytes(raw)
+		assert.True(t, req.isAdmin() || req.isByQuery(), raw)
+
+		err := guard.wrap(func(req *Request) error { return nil })(req)
+		if allowed {
+			assert.NoError(t, err, raw)
+		} else {
+			_, rejected := err.(*ValidationError)
+			assert.True(t, rejected, raw)
+		}
+	}
+
+	// wildcards are allowed when they're in the allowlist as is.
+	req, _ := fromBytes(`{"type": "delete_index", "delete_index": {"index": "tmp-*"}}`)
+	assert.NoError(t, adminGuard{deletable: []string{"tmp-*"}}.check(req))
+
+	// nothing can be deleted without allowlist
+	req, _ = fromBytes(`{"type": "delete_index", "delete_index": {"index": "tmp-123"}}`)
+	assert.Error(t, adminGuard{}.check(req))
+}
@@ -0,0 +1,273 @@
+package redes_writer
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// interval of comments sent on idle event streams, so that proxies keep them open.
+	eventsHeartbeat = 15 * time.Second
+
+	// admin API is only reachable from localhost, unless configured otherwise.
+	DefaultAdminUrl = "127.0.0.1:8484"
+)
+
+// NewAdminHandler serves the admin API of engine:
+//
+//	GET  /                  dashboard
+//	GET  /stats             statistics, including state of the listener
+//	POST /listener/pause    stop dequeueing
+//	POST /listener/resume   continue dequeueing
+//	POST /listener/flush    write requests buffered by bulk processors
+//	POST /listener/drain    pause, then flush all dequeued requests
+//	GET  /queue/peek        pending messages: ?from=head|tail&n=10
+//	GET  /queue/summary     pending requests by index & type: ?sample=1000
+//	GET  /queue/find        pending requests to a document: ?id=1&index=lr&scan=10000
+//	GET  /errors            recent errors: ?index=lr&type=mapper_parsing_exception&severity=error&limit=20
+//	GET  /events            server-sent events: ?kind=request,flush,failure&index=lr*&op=index,delete&sample=0.01
+//
+// Listener endpoints & /events, which streams documents, require admin.token
+// as bearer token, without it they're only served to clients on localhost.
+func NewAdminHandler(engine *Engine) http.Handler {
+	mux := http.NewServeMux()
+	control := func(handler http.HandlerFunc) http.HandlerFunc {
+		return onlyPost(authorized(engine.cnf.Admin.Token, handler))
+	}
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		if "/" != req.URL.Path {
+			writeError(w, http.StatusNotFound, "not found")
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		_, _ = fmt.Fprint(w, dashboardHTML)
+	})
+
+	mux.HandleFunc("/stats", func(w http.ResponseWriter, req *http.Request) {
+		writeJSON(w, http.StatusOK, engine.Stats())
+	})
+
+	mux.HandleFunc("/listener/pause", control(func(w http.ResponseWriter, req *http.Request) {
+		engine.Pause()
+		writeJSON(w, http.StatusOK, engine.ListenerState())
+	}))
+
+	mux.HandleFunc("/listener/resume", control(func(w http.ResponseWriter, req *http.Request) {
+		engine.Resume()
+		writeJSON(w, http.StatusOK, engine.ListenerState())
+	}))
+
+	mux.HandleFunc("/listener/flush", control(func(w http.ResponseWriter, req *http.Request) {
+		if err := engine.Flush(req.Context()); nil != err {
+			writeError(w, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, engine.ListenerState())
+	}))
+
+	mux.HandleFunc("/listener/drain", control(func(w http.ResponseWriter, req *http.Request) {
+		if err := engine.Drain(req.Context()); nil != err {
+			writeError(w, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, engine.ListenerState())
+	}))
+
+	mux.HandleFunc("/queue/peek", func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		items, err := engine.PeekQueue("tail" == query.Get("from"), intParam(query.Get("n")))
+		if nil != err {
+			writeError(w, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, items)
+	})
+
+	mux.HandleFunc("/queue/summary", func(w http.ResponseWriter, req *http.Request) {
+		summary, err := engine.SummarizeQueue(intParam(req.URL.Query().Get("sample")))
+		if nil != err {
+			writeError(w, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, summary)
+	})
+
+	mux.HandleFunc("/queue/find", func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		if "" == query.Get("id") {
+			writeError(w, http.StatusBadRequest, "missing id")
+
+			return
+		}
+
+		search, err := engine.FindInQueue(query.Get("id"), query.Get("index"), intParam(query.Get("scan")))
+		if nil != err {
+			writeError(w, http.StatusInternalServerError, err.Error())
+
+			return
+		}
+
+		writeJSON(w, http.StatusOK, search)
+	})
+
+	mux.HandleFunc("/errors", func(w http.ResponseWriter, req *http.Request) {
+		query := req.URL.Query()
+		writeJSON(w, http.StatusOK, engine.RecentErrors(ErrorFilter{
+			Index:    query.Get("index"),
+			Type:     query.Get("type"),
+			Severity: query.Get("severity"),
+			Limit:    intParam(query.Get("limit")),
+		}))
+	})
+
+	mux.HandleFunc("/events", authorized(engine.cnf.Admin.Token, func(w http.ResponseWriter, req *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			writeError(w, http.StatusInternalServerError, "streaming is not supported")
+
+			return
+		}
+
+		query := req.URL.Query()
+		sample, _ := strconv.ParseFloat(query.Get("sample"), 64)
+		events, cancel := engine.Events(EventFilter{
+			Kinds:  listParam(query.Get("kind")),
+			Index:  query.Get("index"),
+			Ops:    listParam(query.Get("op")),
+			Sample: sample,
+		})
+
+		defer cancel()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventsHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event := <-events:
+				data, err := json.Marshal(event)
+				if nil != err {
+					continue
+				}
+
+				_, _ = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Kind, data)
+
+			case <-heartbeat.C:
+				_, _ = fmt.Fprint(w, ": heartbeat\n\n")
+
+			case <-req.Context().Done():
+				return
+			}
+
+			flusher.Flush()
+		}
+	}))
+
+	return mux
+}
+
+// listParam splits optional comma separated values of query string.
+func listParam(value string) []string {
+	if "" == value {
+		return nil
+	}
+
+	return strings.Split(value, ",")
+}
+
+// intParam parses optional number of query string, 0 when it's invalid.
+func intParam(value string) int {
+	n, _ := strconv.Atoi(value)
+
+	return n
+}
+
+func onlyPost(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if http.MethodPost != req.Method {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// authorized serves requests with the bearer token, or from localhost when
+// there's no token.
+func authorized(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if "" == token {
+			if !isLoopback(req.RemoteAddr) {
+				writeError(w, http.StatusForbidden, "admin token is not configured, only allowed from localhost")
+
+				return
+			}
+		} else if given := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer "); 1 != subtle.ConstantTimeCompare([]byte(given), []byte(token)) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid token")
+
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if nil != err {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+
+	return nil != ip && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	body, err := json.Marshal(value)
+	if nil != err {
+		writeError(w, http.StatusInternalServerError, "failed to encode response: "+err.Error())
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	body, _ := json.Marshal(map[string]string{"error": message})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
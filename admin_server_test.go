@@ -0,0 +1,145 @@
+package redes_writer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGate(t *testing.T) {
+	g := newGate()
+	assert.True(t, g.wait(context.Background()))
+
+	g.pause()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, g.wait(ctx), "closed gate blocks until ctx is cancelled")
+
+	g.resume()
+	assert.True(t, g.wait(context.Background()))
+	assert.False(t, g.wait(ctx), "cancelled listener stops dequeueing")
+	select {
+	case <-g.resumptions():
+	default:
+		t.Error("resuming must be signalled")
+	}
+
+	g.acquire()
+	assert.False(t, g.idle())
+	g.release()
+	assert.True(t, g.idle())
+
+	// gate is optional.
+	var none *gate
+	assert.True(t, none.wait(context.Background()))
+	none.acquire()
+	none.release()
+}
+
+func TestAdminHandler_Listener(t *testing.T) {
+	cnf := &Config{}
+	cnf.Admin.Token = "secret"
+	engine, err := NewEngine(Options{Config: cnf})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	handler := NewAdminHandler(engine)
+	call := func(method string, path string) (int, ListenerState) {
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		handler.ServeHTTP(res, req)
+
+		state := ListenerState{}
+		_ = json.Unmarshal(res.Body.Bytes(), &state)
+
+		return res.Code, state
+	}
+
+	code, _ := call(http.MethodGet, "/listener/pause")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+
+	code, state := call(http.MethodPost, "/listener/pause")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ListenerPaused, state.State)
+	assert.NotNil(t, state.PausedAt)
+
+	code, state = call(http.MethodPost, "/listener/resume")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ListenerRunning, state.State)
+
+	code, _ = call(http.MethodPost, "/listener/flush")
+	assert.Equal(t, http.StatusOK, code)
+
+	// drain waits for the message in flight.
+	engine.gate.acquire()
+	drained := make(chan int)
+	go func() {
+		code, _ := call(http.MethodPost, "/listener/drain")
+		drained <- code
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, ListenerDraining, engine.Stats().Listener.State)
+	assert.Equal(t, 1, engine.Stats().Listener.InFlight)
+
+	engine.gate.release()
+	assert.Equal(t, http.StatusOK, <-drained)
+	assert.Equal(t, ListenerPaused, engine.ListenerState().State, "drained listener stays paused")
+}
+
+func TestAdminHandler_Authorized(t *testing.T) {
+	call := func(token string, remoteAddr string, authorization string) int {
+		cnf := &Config{}
+		cnf.Admin.Token = token
+		engine, err := NewEngine(Options{Config: cnf})
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		res := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/listener/pause", nil)
+		req.RemoteAddr = remoteAddr
+		if "" != authorization {
+			req.Header.Set("Authorization", authorization)
+		}
+
+		NewAdminHandler(engine).ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	// without token, only localhost.
+	assert.Equal(t, http.StatusOK, call("", "127.0.0.1:5000", ""))
+	assert.Equal(t, http.StatusOK, call("", "[::1]:5000", ""))
+	assert.Equal(t, http.StatusForbidden, call("", "10.0.0.1:5000", ""))
+	assert.Equal(t, http.StatusForbidden, call("", "10.0.0.1:5000", "Bearer anything"))
+
+	// with token, from anywhere, localhost included.
+	assert.Equal(t, http.StatusOK, call("secret", "10.0.0.1:5000", "Bearer secret"))
+	assert.Equal(t, http.StatusUnauthorized, call("secret", "10.0.0.1:5000", "Bearer wrong"))
+	assert.Equal(t, http.StatusUnauthorized, call("secret", "127.0.0.1:5000", ""))
+}
+
+func TestAdminHandler_Dashboard(t *testing.T) {
+	engine, err := NewEngine(Options{Config: &Config{}})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	NewAdminHandler(engine).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	assert.Contains(t, res.Body.String(), `fetch("stats")`)
+
+	res = httptest.NewRecorder()
+	NewAdminHandler(engine).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
@@ -0,0 +1,216 @@
+package redes_writer
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	// default number of requests in one bulk, same as elastic.BulkProcessor.
+	defaultBulkActions = 1000
+
+	defaultMaxLatency = 5 * time.Second
+	defaultMinBatch   = 10
+	defaultMaxRate    = 5000
+
+	// batch size & throughput target are increased by this fraction of their
+	// maximum after each healthy bulk.
+	backpressureIncrease = 0.05
+)
+
+type (
+	// backpressure adapts batch size & throughput target of one cluster to
+	// how Elastic Search copes with the load, AIMD-style: halved when a bulk
+	// is rejected with 429 or slower than maxLatency, increased by small
+	// steps when bulks are healthy.
+	backpressure struct {
+		mu         sync.Mutex
+		cluster    string
+		counters   *Counters
+		now        func() time.Time
+		maxLatency time.Duration
+		minBatch   int
+		maxBatch   int
+		minRate    float64
+		maxRate    float64
+		batch      int // effective batch size
+		added      int // requests added since last bulk
+		started    map[int64]time.Time
+		latency    time.Duration // of last bulk
+		bucket     *tokenBucket  // throughput target
+		stop       chan struct{}
+		stopOnce   sync.Once
+	}
+
+	// BackpressureStats is current state of adaptive backpressure of a cluster.
+	BackpressureStats struct {
+		BatchSize  int     `json:"batchSize"`
+		TargetRate float64 `json:"targetRate"` // requests per second
+		Latency    string  `json:"latency"`    // of last bulk
+	}
+)
+
+func newBackpressure(cluster string, cnf *Config, counters *Counters) *backpressure {
+	b := &backpressure{
+		cluster:    cluster,
+		counters:   counters,
+		now:        time.Now,
+		maxLatency: cnf.Listener.Backpressure.MaxLatency,
+		minBatch:   cnf.Listener.Backpressure.MinBatch,
+		maxBatch:   defaultBulkActions,
+		maxRate:    cnf.Listener.Backpressure.MaxRate,
+		started:    map[int64]time.Time{},
+		stop:       make(chan struct{}),
+	}
+
+	if cnf.Listener.BulkActions > 0 {
+		b.maxBatch = cnf.Listener.BulkActions
+	}
+
+	if 0 == b.maxLatency {
+		b.maxLatency = defaultMaxLatency
+	}
+
+	if b.minBatch <= 0 {
+		b.minBatch = defaultMinBatch
+	}
+
+	if b.minBatch > b.maxBatch {
+		b.minBatch = b.maxBatch
+	}
+
+	if b.maxRate <= 0 {
+		b.maxRate = defaultMaxRate
+	}
+
+	b.minRate = math.Max(1, b.maxRate/100)
+	b.batch = b.maxBatch
+	b.bucket = &tokenBucket{name: cluster, rate: b.maxRate, burst: b.maxRate, tokens: b.maxRate}
+
+	return b
+}
+
+// add counts request added to the bulk processor, returns true when the
+// batch is full and should be flushed.
+func (b *backpressure) add() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.added++
+
+	return b.added >= b.batch
+}
+
+// delay returns how long to wait before dequeueing next request, to keep
+// throughput under the target.
+func (b *backpressure) delay() time.Duration {
+	delay, _ := b.bucket.take(b.now())
+
+	return delay
+}
+
+// throttle waits before writing next request to keep throughput under the
+// target, until ctx is cancelled or backpressure is stopped.
+func (b *backpressure) throttle(ctx context.Context) {
+	if nil == b {
+		return
+	}
+
+	delay := b.delay()
+	if delay <= 0 {
+		return
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-b.stop:
+	case <-ctx.Done():
+	}
+}
+
+// shutdown stops throttling, so that closing cluster writes buffered requests
+// without waiting.
+func (b *backpressure) shutdown() {
+	if nil != b {
+		b.stopOnce.Do(func() { close(b.stop) })
+	}
+}
+
+func (b *backpressure) before(executionId int64, requests []elastic.BulkableRequest) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.added = 0
+	b.started[executionId] = b.now()
+}
+
+func (b *backpressure) after(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if started, ok := b.started[executionId]; ok {
+		b.latency = b.now().Sub(started)
+		delete(b.started, executionId)
+	}
+
+	overloaded := elastic.IsStatusCode(err, http.StatusTooManyRequests) || b.latency > b.maxLatency
+	if nil != response {
+		for _, item := range response.Items {
+			for _, result := range item {
+				if http.StatusTooManyRequests == result.Status {
+					overloaded = true
+				}
+			}
+		}
+	}
+
+	rate := b.bucket.rate
+	if overloaded {
+		b.batch = maxInt(b.minBatch, b.batch/2)
+		rate = math.Max(b.minRate, rate/2)
+		b.counters.Add("cluster."+b.cluster+".backpressure.decreased", 1)
+	} else {
+		b.batch = minInt(b.maxBatch, b.batch+maxInt(1, int(float64(b.maxBatch)*backpressureIncrease)))
+		rate = math.Min(b.maxRate, rate+b.maxRate*backpressureIncrease)
+	}
+
+	b.bucket.setRate(rate, b.now())
+}
+
+func (b *backpressure) stats() BackpressureStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bucket.mu.Lock()
+	defer b.bucket.mu.Unlock()
+
+	return BackpressureStats{
+		BatchSize:  b.batch,
+		TargetRate: b.bucket.rate,
+		Latency:    b.latency.String(),
+	}
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+
+	return b
+}
@@ -0,0 +1,84 @@
+package redes_writer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackpressure(t *testing.T) {
+	cnf := &Config{}
+	cnf.Listener.Backpressure.MaxLatency = time.Second
+	cnf.Listener.Backpressure.MinBatch = 100
+	cnf.Listener.Backpressure.MaxRate = 1000
+
+	counters := NewCounters()
+	bp := newBackpressure("default", cnf, counters)
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	bp.now = func() time.Time { return now }
+
+	bulk := func(id int64, latency time.Duration, response *elastic.BulkResponse, err error) {
+		bp.before(id, nil)
+		now = now.Add(latency)
+		bp.after(id, nil, response, err)
+	}
+
+	assert.Equal(t, BackpressureStats{BatchSize: 1000, TargetRate: 1000, Latency: "0s"}, bp.stats())
+
+	// slow bulk.
+	bulk(1, 2*time.Second, nil, nil)
+	assert.Equal(t, BackpressureStats{BatchSize: 500, TargetRate: 500, Latency: "2s"}, bp.stats())
+
+	// rejected items.
+	bulk(2, 10*time.Millisecond, &elastic.BulkResponse{Items: []map[string]*elastic.BulkResponseItem{
+		{"index": {Status: 429}},
+	}}, nil)
+	assert.Equal(t, BackpressureStats{BatchSize: 250, TargetRate: 250, Latency: "10ms"}, bp.stats())
+
+	// rejected bulk, batch size does not go under minimum.
+	bulk(3, 10*time.Millisecond, nil, &elastic.Error{Status: 429})
+	bulk(4, 10*time.Millisecond, nil, &elastic.Error{Status: 429})
+	assert.Equal(t, BackpressureStats{BatchSize: 100, TargetRate: 62.5, Latency: "10ms"}, bp.stats())
+	assert.Equal(t, int64(4), counters.Get("cluster.default.backpressure.decreased"))
+
+	// healthy bulks ramp back up.
+	for i := int64(5); i < 50; i++ {
+		bulk(i, 10*time.Millisecond, nil, nil)
+	}
+
+	assert.Equal(t, BackpressureStats{BatchSize: 1000, TargetRate: 1000, Latency: "10ms"}, bp.stats())
+
+	// batch is full at effective batch size.
+	bp.batch = 3
+	full := []bool{bp.add(), bp.add(), bp.add()}
+	assert.Equal(t, []bool{false, false, true}, full)
+}
+
+func TestBackpressure_Throttle(t *testing.T) {
+	cnf := &Config{}
+	cnf.Listener.Backpressure.MaxRate = 1
+
+	bp := newBackpressure("default", cnf, NewCounters())
+	bp.bucket.tokens = 0
+
+	// throttled cluster does not hold the writer.
+	c := &Cluster{Name: "default", Default: true, ctx: context.Background(), pending: make(chan *Request, 1), counters: NewCounters(), bp: bp}
+	start := time.Now()
+	assert.NoError(t, c.write(&Request{Type: "delete"}))
+	assert.True(t, time.Since(start) < 100*time.Millisecond)
+
+	// throttling stops when ctx is cancelled or on shutdown.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	bp.throttle(ctx)
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+
+	bp.shutdown()
+	start = time.Now()
+	bp.throttle(context.Background())
+	assert.True(t, time.Since(start) < 500*time.Millisecond)
+}
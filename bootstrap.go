@@ -0,0 +1,486 @@
+package redes_writer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// settings which can only be set when index is created.
+var staticIndexSettings = []string{
+	"index.number_of_shards",
+	"index.number_of_routing_shards",
+	"index.routing_partition_size",
+	"index.codec",
+	"index.shard.check_on_startup",
+}
+
+// IndexChange is one change to indices, templates or ILM policies which
+// es-writer applies to a cluster at startup.
+type IndexChange struct {
+	Cluster string   `json:"cluster"`
+	Kind    string   `json:"kind"`   // policy, template, index, mappings, settings, aliases
+	Name    string   `json:"name"`   // name of policy, template or index
+	Action  string   `json:"action"` // create, update or reindex
+	Diff    []string `json:"diff,omitempty"`
+
+	// nil for changes which es-writer can't apply, e.g. static settings of
+	// existing index: the index must be reindexed, or closed to be updated.
+	apply func(ctx context.Context) error
+}
+
+func (c IndexChange) String() string {
+	lines := []string{fmt.Sprintf("[%s] %s %s %s", c.Cluster, c.Action, c.Kind, c.Name)}
+	for _, line := range c.Diff {
+		lines = append(lines, "    "+line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// BootstrapIndices compares declared indices, templates & ILM policies with
+// all configured clusters and applies the differences, unless dryRun.
+func BootstrapIndices(ctx context.Context, cnf *Config, dryRun bool) ([]IndexChange, error) {
+	changes := []IndexChange{}
+	for _, clusterCnf := range clusterConfigs(cnf) {
+		client, err := newElasticSearchClient(clusterCnf.Url)
+		if nil != err {
+			return nil, err
+		}
+
+		clusterChanges, err := bootstrapIndices(ctx, clusterCnf.Name, client, cnf.Indices, dryRun)
+		if nil != err {
+			return nil, err
+		}
+
+		changes = append(changes, clusterChanges...)
+	}
+
+	return changes, nil
+}
+
+func bootstrapIndices(ctx context.Context, cluster string, client *elastic.Client, cnf IndicesConfig, dryRun bool) ([]IndexChange, error) {
+	changes := []IndexChange{}
+
+	for _, policy := range cnf.Policies {
+		change, err := planPolicy(ctx, client, policy)
+		if nil != err {
+			return nil, err
+		}
+
+		if nil != change {
+			changes = append(changes, *change)
+		}
+	}
+
+	for _, template := range cnf.Templates {
+		change, err := planTemplate(ctx, client, template)
+		if nil != err {
+			return nil, err
+		}
+
+		if nil != change {
+			changes = append(changes, *change)
+		}
+	}
+
+	for _, index := range cnf.Indices {
+		indexChanges, err := planIndex(ctx, client, index)
+		if nil != err {
+			return nil, err
+		}
+
+		changes = append(changes, indexChanges...)
+	}
+
+	for i := range changes {
+		changes[i].Cluster = cluster
+
+		if dryRun {
+			continue
+		}
+
+		if nil == changes[i].apply {
+			logrus.WithField("cluster", cluster).Warnln(changes[i].String())
+			continue
+		}
+
+		if err := changes[i].apply(ctx); nil != err {
+			return nil, fmt.Errorf("failed to %s %s %s on cluster %s: %s", changes[i].Action, changes[i].Kind, changes[i].Name, cluster, err)
+		}
+
+		logrus.WithField("cluster", cluster).Infoln(changes[i].String())
+	}
+
+	return changes, nil
+}
+
+func planPolicy(ctx context.Context, client *elastic.Client, cnf IlmPolicyConfig) (*IndexChange, error) {
+	desired := normalizeYaml(cnf.Policy)
+	change := &IndexChange{Kind: "policy", Name: cnf.Name, Action: "create"}
+	change.apply = func(ctx context.Context) error {
+		_, err := client.XPackIlmPutLifecycle().Policy(cnf.Name).BodyJson(map[string]interface{}{"policy": desired}).Do(ctx)
+
+		return err
+	}
+
+	res, err := client.XPackIlmGetLifecycle().Policy(cnf.Name).Do(ctx)
+	if elastic.IsNotFound(err) || (nil == err && nil == res[cnf.Name]) {
+		return change, nil
+	} else if nil != err {
+		return nil, err
+	}
+
+	change.Action = "update"
+	change.Diff = diffJson("policy", desired, toJsonValue(res[cnf.Name].Policy))
+	if 0 == len(change.Diff) {
+		return nil, nil
+	}
+
+	return change, nil
+}
+
+func planTemplate(ctx context.Context, client *elastic.Client, cnf IndexTemplateConfig) (*IndexChange, error) {
+	desired, _ := normalizeYaml(cnf.Body).(map[string]interface{})
+	change := &IndexChange{Kind: "template", Name: cnf.Name, Action: "create"}
+	change.apply = func(ctx context.Context) error {
+		_, err := client.IndexPutTemplate(cnf.Name).BodyJson(desired).Do(ctx)
+
+		return err
+	}
+
+	res, err := client.IndexGetTemplate(cnf.Name).Do(ctx)
+	if elastic.IsNotFound(err) || (nil == err && nil == res[cnf.Name]) {
+		return change, nil
+	} else if nil != err {
+		return nil, err
+	}
+
+	actual, _ := toJsonValue(res[cnf.Name]).(map[string]interface{})
+	change.Action = "update"
+	for _, key := range sortedKeys(desired) {
+		if "settings" == key {
+			diff, _ := diffSettings(desired[key], actual[key], nil)
+			change.Diff = append(change.Diff, diff...)
+		} else {
+			change.Diff = append(change.Diff, diffJson(key, desired[key], actual[key])...)
+		}
+	}
+
+	if 0 == len(change.Diff) {
+		return nil, nil
+	}
+
+	return change, nil
+}
+
+func planIndex(ctx context.Context, client *elastic.Client, cnf IndexConfig) ([]IndexChange, error) {
+	settings := normalizeYaml(cnf.Settings)
+	mappings := normalizeYaml(cnf.Mappings)
+
+	res, err := client.IndexGet(cnf.Name).Do(ctx)
+	if elastic.IsNotFound(err) {
+		body := map[string]interface{}{}
+		if nil != settings {
+			body["settings"] = settings
+		}
+
+		if nil != mappings {
+			body["mappings"] = mappings
+		}
+
+		if len(cnf.Aliases) > 0 {
+			aliases := map[string]interface{}{}
+			for _, alias := range cnf.Aliases {
+				aliases[alias] = map[string]interface{}{}
+			}
+
+			body["aliases"] = aliases
+		}
+
+		return []IndexChange{{
+			Kind:   "index",
+			Name:   cnf.Name,
+			Action: "create",
+			apply: func(ctx context.Context) error {
+				_, err := client.CreateIndex(cnf.Name).BodyJson(body).Do(ctx)
+
+				return err
+			},
+		}}, nil
+	} else if nil != err {
+		return nil, err
+	}
+
+	// name may be an alias of the actual index.
+	var actual *elastic.IndicesGetResponse
+	for _, item := range res {
+		actual = item
+	}
+
+	changes := []IndexChange{}
+
+	added, changed, body := diffMappings(mappings, toJsonValue(actual.Mappings))
+	if len(added) > 0 {
+		changes = append(changes, IndexChange{
+			Kind:   "mappings",
+			Name:   cnf.Name,
+			Action: "update",
+			Diff:   added,
+			apply: func(ctx context.Context) error {
+				_, err := client.PutMapping().Index(cnf.Name).BodyJson(body).Do(ctx)
+
+				return err
+			},
+		})
+	}
+
+	if len(changed) > 0 {
+		changes = append(changes, IndexChange{Kind: "mappings", Name: cnf.Name, Action: "reindex", Diff: changed})
+	}
+
+	dynamic := map[string]interface{}{}
+	diff, static := diffSettings(settings, toJsonValue(actual.Settings), dynamic)
+	if len(diff) > 0 {
+		changes = append(changes, IndexChange{
+			Kind:   "settings",
+			Name:   cnf.Name,
+			Action: "update",
+			Diff:   diff,
+			apply: func(ctx context.Context) error {
+				_, err := client.IndexPutSettings(cnf.Name).BodyJson(dynamic).Do(ctx)
+
+				return err
+			},
+		})
+	}
+
+	if len(static) > 0 {
+		changes = append(changes, IndexChange{Kind: "settings", Name: cnf.Name, Action: "reindex", Diff: static})
+	}
+
+	missing := []string{}
+	for _, alias := range cnf.Aliases {
+		if _, ok := actual.Aliases[alias]; !ok {
+			missing = append(missing, alias)
+		}
+	}
+
+	if len(missing) > 0 {
+		diff := []string{}
+		for _, alias := range missing {
+			diff = append(diff, "+ "+alias)
+		}
+
+		changes = append(changes, IndexChange{
+			Kind:   "aliases",
+			Name:   cnf.Name,
+			Action: "update",
+			Diff:   diff,
+			apply: func(ctx context.Context) error {
+				service := client.Alias()
+				for _, alias := range missing {
+					service.Add(cnf.Name, alias)
+				}
+
+				_, err := service.Do(ctx)
+
+				return err
+			},
+		})
+	}
+
+	return changes, nil
+}
+
+// diffJson lists differences of desired from actual value, properties which
+// are not declared in desired value are ignored.
+func diffJson(path string, desired interface{}, actual interface{}) []string {
+	if nil == desired {
+		return nil
+	}
+
+	desiredObject, ok := desired.(map[string]interface{})
+	if !ok {
+		if jsonString(desired) != jsonString(actual) {
+			return []string{fmt.Sprintf("~ %s: %s => %s", path, jsonString(actual), jsonString(desired))}
+		}
+
+		return nil
+	}
+
+	actualObject, _ := actual.(map[string]interface{})
+	diff := []string{}
+	for _, key := range sortedKeys(desiredObject) {
+		if _, ok := actualObject[key]; !ok {
+			diff = append(diff, fmt.Sprintf("+ %s.%s: %s", path, key, jsonString(desiredObject[key])))
+			continue
+		}
+
+		diff = append(diff, diffJson(path+"."+key, desiredObject[key], actualObject[key])...)
+	}
+
+	return diff
+}
+
+// diffMappings splits differences of mappings into added properties, which are
+// put by body, and changed ones, e.g. type of auto-mapped field: Elastic Search
+// refuses to change them on existing index.
+func diffMappings(desired interface{}, actual interface{}) (added []string, changed []string, body map[string]interface{}) {
+	for _, line := range diffJson("mappings", desired, actual) {
+		if strings.HasPrefix(line, "+ ") {
+			added = append(added, line)
+		} else {
+			changed = append(changed, line+" (requires reindex)")
+		}
+	}
+
+	body, _ = addedJson(desired, actual).(map[string]interface{})
+
+	return added, changed, body
+}
+
+// addedJson keeps properties of desired value which are missing in actual
+// value. Type of field is kept with its added properties, e.g. multi-fields.
+func addedJson(desired interface{}, actual interface{}) interface{} {
+	desiredObject, ok := desired.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	actualObject, _ := actual.(map[string]interface{})
+	added := map[string]interface{}{}
+	for key, value := range desiredObject {
+		actualValue, ok := actualObject[key]
+		if !ok {
+			added[key] = value
+		} else if object := addedJson(value, actualValue); nil != object {
+			added[key] = object
+		}
+	}
+
+	if 0 == len(added) {
+		return nil
+	}
+
+	if fieldType, ok := desiredObject["type"]; ok {
+		added["type"] = fieldType
+	}
+
+	return added
+}
+
+// diffSettings compares index settings in flat form, e.g. index.number_of_replicas.
+// When dynamic is not nil, changed dynamic settings are collected into it and
+// changed static settings are listed apart, they can't be updated on open index.
+func diffSettings(desired interface{}, actual interface{}, dynamic map[string]interface{}) (diff []string, static []string) {
+	desiredFlat := flattenSettings(desired)
+	actualFlat := flattenSettings(actual)
+
+	for _, key := range sortedKeys(desiredFlat) {
+		value, ok := actualFlat[key]
+		if ok && jsonString(value) == jsonString(desiredFlat[key]) {
+			continue
+		}
+
+		line := fmt.Sprintf("~ settings.%s: %s => %s", key, jsonString(value), jsonString(desiredFlat[key]))
+		if !ok {
+			line = fmt.Sprintf("+ settings.%s: %s", key, jsonString(desiredFlat[key]))
+		}
+
+		if nil != dynamic && contains(staticIndexSettings, key) {
+			static = append(static, line+" (static setting, requires reindex or closing index)")
+			continue
+		}
+
+		if nil != dynamic {
+			dynamic[key] = desiredFlat[key]
+		}
+
+		diff = append(diff, line)
+	}
+
+	return diff, static
+}
+
+// flattenSettings converts {"index": {"number_of_shards": 1}} & {"number_of_shards": 1}
+// into {"index.number_of_shards": 1}.
+func flattenSettings(settings interface{}) map[string]interface{} {
+	flat := map[string]interface{}{}
+	if nil == settings {
+		return flat
+	}
+
+	var walk func(prefix string, value interface{})
+	walk = func(prefix string, value interface{}) {
+		if object, ok := value.(map[string]interface{}); ok {
+			for key, item := range object {
+				if "" == prefix {
+					walk(key, item)
+				} else {
+					walk(prefix+"."+key, item)
+				}
+			}
+
+			return
+		}
+
+		if !strings.HasPrefix(prefix, "index.") {
+			prefix = "index." + prefix
+		}
+
+		flat[prefix] = value
+	}
+
+	walk("", settings)
+
+	return flat
+}
+
+// toJsonValue converts responses into generic JSON values, same as documents.
+func toJsonValue(value interface{}) interface{} {
+	raw, err := json.Marshal(value)
+	if nil != err {
+		return nil
+	}
+
+	var out interface{}
+	_ = json.Unmarshal(raw, &out)
+
+	return out
+}
+
+// jsonString is used to compare values, Elastic Search returns numbers &
+// booleans in settings as strings.
+func jsonString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+
+	case string:
+		return v
+
+	case bool, int, int64, float64:
+		return fmt.Sprint(v)
+	}
+
+	raw, _ := json.Marshal(value)
+
+	return string(raw)
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,101 @@
+package redes_writer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffJson(t *testing.T) {
+	desired := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"name":       map[string]interface{}{"type": "keyword"},
+			"created_at": map[string]interface{}{"type": "date"},
+		},
+	}
+
+	actual := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"name":  map[string]interface{}{"type": "text"},
+			"other": map[string]interface{}{"type": "long"},
+		},
+	}
+
+	assert.Equal(t, []string{
+		`+ mappings.properties.created_at: {"type":"date"}`,
+		`~ mappings.properties.name.type: text => keyword`,
+	}, diffJson("mappings", desired, actual))
+
+	assert.Empty(t, diffJson("mappings", desired, desired))
+	assert.Empty(t, diffJson("mappings", nil, actual))
+}
+
+func TestDiffMappings(t *testing.T) {
+	desired := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"title":      map[string]interface{}{"type": "text", "fields": map[string]interface{}{"raw": map[string]interface{}{"type": "keyword"}}},
+			"created_at": map[string]interface{}{"type": "date"},
+			"tags":       map[string]interface{}{"type": "keyword"},
+		},
+	}
+
+	// index was created by the first request, created_at is auto-mapped.
+	actual := map[string]interface{}{
+		"properties": map[string]interface{}{
+			"title":      map[string]interface{}{"type": "text"},
+			"created_at": map[string]interface{}{"type": "text"},
+		},
+	}
+
+	added, changed, body := diffMappings(desired, actual)
+	assert.Equal(t, []string{
+		`+ mappings.properties.tags: {"type":"keyword"}`,
+		`+ mappings.properties.title.fields: {"raw":{"type":"keyword"}}`,
+	}, added)
+
+	assert.Equal(t, []string{`~ mappings.properties.created_at.type: text => date (requires reindex)`}, changed)
+	assert.Equal(t, map[string]interface{}{
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"type": "text", "fields": map[string]interface{}{"raw": map[string]interface{}{"type": "keyword"}}},
+			"tags":  map[string]interface{}{"type": "keyword"},
+		},
+	}, body)
+
+	added, changed, body = diffMappings(desired, desired)
+	assert.Empty(t, added)
+	assert.Empty(t, changed)
+	assert.Nil(t, body)
+}
+
+func TestDiffSettings(t *testing.T) {
+	desired := map[string]interface{}{
+		"number_of_shards":   2,
+		"number_of_replicas": 1,
+		"index":              map[string]interface{}{"refresh_interval": "5s"},
+	}
+
+	// Elastic Search returns settings as strings
+	actual := map[string]interface{}{
+		"index": map[string]interface{}{"number_of_shards": "1", "number_of_replicas": "1", "uuid": "abc"},
+	}
+
+	dynamic := map[string]interface{}{}
+	diff, static := diffSettings(desired, actual, dynamic)
+	assert.Equal(t, []string{`+ settings.index.refresh_interval: 5s`}, diff)
+	assert.Equal(t, []string{`~ settings.index.number_of_shards: 1 => 2 (static setting, requires reindex or closing index)`}, static)
+	assert.Equal(t, map[string]interface{}{"index.refresh_interval": "5s"}, dynamic)
+
+	// unchanged static settings are not reported.
+	desired["number_of_shards"] = 1
+	dynamic = map[string]interface{}{}
+	_, static = diffSettings(desired, actual, dynamic)
+	assert.Empty(t, static)
+
+	// templates only apply to new indices, static settings are updated as others.
+	diff, static = diffSettings(map[string]interface{}{"number_of_shards": 2}, actual, nil)
+	assert.Equal(t, []string{`~ settings.index.number_of_shards: 1 => 2`}, diff)
+	assert.Empty(t, static)
+
+	diff, _ = diffSettings(nil, actual, nil)
+	assert.Empty(t, diff)
+}
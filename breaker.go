@@ -0,0 +1,187 @@
+package redes_writer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultBreakerInterval = 5 * time.Second
+	defaultBreakerFailures = 3
+)
+
+type (
+	// breaker checks health of a cluster, it's open after some consecutive
+	// failed checks and closed again by the first successful check. While
+	// breaker is open, requests are not dequeued for the cluster.
+	breaker struct {
+		mu        sync.Mutex
+		cluster   string
+		counters  *Counters
+		check     func(ctx context.Context) error
+		interval  time.Duration
+		threshold int
+		failures  int
+		open      bool
+		lastError string
+		closedCh  chan struct{} // closed while breaker is closed
+		recovered chan struct{}
+		stop      chan struct{}
+		stopOnce  sync.Once
+	}
+
+	// BreakerStats is current state of circuit breaker of a cluster.
+	BreakerStats struct {
+		Open      bool   `json:"open"`
+		Failures  int    `json:"failures"`
+		LastError string `json:"lastError,omitempty"`
+		Spooled   int    `json:"spooled"` // requests waiting in disk spool
+	}
+)
+
+func newBreaker(cluster string, client *elastic.Client, cnf *Config, counters *Counters) *breaker {
+	b := &breaker{
+		cluster:   cluster,
+		counters:  counters,
+		interval:  cnf.Listener.Breaker.Interval,
+		threshold: cnf.Listener.Breaker.Failures,
+		closedCh:  make(chan struct{}),
+		recovered: make(chan struct{}, 1),
+		stop:      make(chan struct{}),
+	}
+
+	close(b.closedCh)
+
+	if b.interval <= 0 {
+		b.interval = defaultBreakerInterval
+	}
+
+	if b.threshold <= 0 {
+		b.threshold = defaultBreakerFailures
+	}
+
+	b.check = func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, b.interval)
+		defer cancel()
+
+		res, err := client.ClusterHealth().Do(ctx)
+		if nil != err {
+			return err
+		}
+
+		if "red" == res.Status {
+			return fmt.Errorf("cluster health is red")
+		}
+
+		return nil
+	}
+
+	return b
+}
+
+// run checks health of the cluster, until ctx is cancelled.
+func (b *breaker) run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-b.stop:
+			return
+
+		case <-ticker.C:
+			b.report(b.check(ctx))
+		}
+	}
+}
+
+// report updates state of breaker by result of a health check.
+func (b *breaker) report(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if nil == err {
+		b.failures = 0
+		b.lastError = ""
+		if b.open {
+			b.open = false
+			close(b.closedCh)
+			logrus.WithField("cluster", b.cluster).Infoln("circuit breaker closed")
+
+			select {
+			case b.recovered <- struct{}{}:
+			default:
+			}
+		}
+
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if !b.open && b.failures >= b.threshold {
+		b.open = true
+		b.closedCh = make(chan struct{})
+		b.counters.Add("cluster."+b.cluster+".breaker.opened", 1)
+		logrus.WithError(err).WithField("cluster", b.cluster).Errorln("circuit breaker opened")
+	}
+}
+
+func (b *breaker) isOpen() bool {
+	if nil == b {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.open
+}
+
+// wait blocks while breaker is open, until it's closed or stopped.
+func (b *breaker) wait(ctx context.Context) {
+	if nil == b {
+		return
+	}
+
+	b.mu.Lock()
+	closedCh := b.closedCh
+	b.mu.Unlock()
+
+	select {
+	case <-closedCh:
+	case <-b.stop:
+	case <-ctx.Done():
+	}
+}
+
+// recoveries signals when breaker is closed, nil channel when there's no breaker.
+func (b *breaker) recoveries() chan struct{} {
+	if nil == b {
+		return nil
+	}
+
+	return b.recovered
+}
+
+// shutdown releases all waiting writers.
+func (b *breaker) shutdown() {
+	if nil != b {
+		b.stopOnce.Do(func() { close(b.stop) })
+	}
+}
+
+func (b *breaker) stats() BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return BreakerStats{Open: b.open, Failures: b.failures, LastError: b.lastError}
+}
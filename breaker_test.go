@@ -0,0 +1,115 @@
+package redes_writer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreaker(t *testing.T) {
+	cnf := &Config{}
+	cnf.Listener.Breaker.Failures = 2
+
+	counters := NewCounters()
+	b := newBreaker("es7", nil, cnf, counters)
+
+	b.report(fmt.Errorf("connection refused"))
+	assert.False(t, b.isOpen())
+
+	b.report(fmt.Errorf("connection refused"))
+	assert.True(t, b.isOpen())
+	assert.Equal(t, BreakerStats{Open: true, Failures: 2, LastError: "connection refused"}, b.stats())
+	assert.Equal(t, int64(1), counters.Get("cluster.es7.breaker.opened"))
+
+	waited := make(chan struct{})
+	go func() {
+		b.wait(context.Background())
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Error("writer must wait while breaker is open")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	b.report(nil)
+	<-waited
+	<-b.recoveries()
+	assert.False(t, b.isOpen())
+	assert.Equal(t, BreakerStats{}, b.stats())
+
+	// no breaker configured.
+	var none *breaker
+	assert.False(t, none.isOpen())
+	none.wait(context.Background())
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-writer-spool")
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer os.RemoveAll(dir)
+
+	s, err := newSpool(dir, "es7", 2000)
+	assert.NoError(t, err)
+
+	r1, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"a": 1}}}`)
+	r2, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`)
+	assert.NoError(t, s.write(r1))
+	assert.NoError(t, s.write(r2))
+	assert.EqualError(t, s.write(r1), "spool "+dir+"/es7.ndjson is full")
+	assert.Equal(t, 2, s.len())
+
+	// spooled requests are kept after restart.
+	s, err = newSpool(dir, "es7", 2000)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.len())
+
+	replayed := []string{}
+	assert.NoError(t, s.replay(func(req *Request) {
+		replayed = append(replayed, req.Type+":"+req.key())
+	}))
+
+	assert.Equal(t, []string{"index:" + r1.key(), "delete:" + r2.key()}, replayed)
+	assert.Equal(t, 0, s.len())
+
+	_, err = os.Stat(dir + "/es7.ndjson")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestClusters_WriteWhileBreakerOpen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cnf := &Config{}
+	cnf.Listener.Breaker.Failures = 1
+	counters := NewCounters()
+
+	down := &Cluster{Name: "down", Default: true, ctx: ctx, pending: make(chan *Request, 1), counters: counters}
+	down.breaker = newBreaker("down", nil, cnf, counters)
+	down.breaker.report(fmt.Errorf("connection refused"))
+	healthy := &Cluster{Name: "healthy", Default: true, ctx: ctx, pending: make(chan *Request, 1), counters: counters}
+
+	// open breaker of a mirror doesn't hold writing to the others.
+	written := make(chan error)
+	go func() { written <- Clusters{down, healthy}.write(&Request{Type: "delete"}) }()
+
+	select {
+	case err := <-written:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Error("writing waits for open breaker")
+	}
+
+	assert.Len(t, down.pending, 1)
+	assert.Len(t, healthy.pending, 1)
+}
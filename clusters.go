@@ -0,0 +1,539 @@
+package redes_writer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	// Cluster is one Elastic Search cluster which es-writer writes to.
+	// Each cluster has its own bulk processor and buffer, so that a cluster
+	// being down doesn't block writing to others.
+	Cluster struct {
+		Name      string
+		Default   bool
+		Client    *elastic.Client
+		Processor *elastic.BulkProcessor
+
+		ctx       context.Context // cancelled when es-writer gives up writing
+		mu        sync.RWMutex
+		closed    bool
+		pending   chan *Request
+		flushes   chan chan error
+		done      chan struct{}
+		coalescer *coalescer
+		bp        *backpressure // optional
+		breaker   *breaker      // optional
+		spool     *spool        // optional
+		tasks     *taskTracker
+		report    func(err error) // optional, failed requests which are not bulk-able
+		counters  *Counters
+	}
+
+	Clusters []*Cluster
+)
+
+// clusterConfigs returns all configured clusters, elasticsearch.url is the
+// default cluster named "default".
+func clusterConfigs(cnf *Config) []ClusterConfig {
+	configs := []ClusterConfig{}
+	if "" != cnf.ElasticSearch.Url {
+		configs = append(configs, ClusterConfig{Name: defaultCluster, Url: cnf.ElasticSearch.Url, Default: true})
+	}
+
+	return append(configs, cnf.ElasticSearch.Clusters...)
+}
+
+// clients are optional, by cluster name.
+func newClusters(ctx context.Context, cnf *Config, counters *Counters, clients map[string]*elastic.Client, hooks processorHooks) (Clusters, error) {
+	clusters := Clusters{}
+	for _, clusterCnf := range clusterConfigs(cnf) {
+		if nil != clusters.get(clusterCnf.Name) {
+			return nil, fmt.Errorf("duplicated cluster %q", clusterCnf.Name)
+		}
+
+		client, ok := clients[clusterCnf.Name]
+		if !ok {
+			var err error
+			if client, err = newElasticSearchClient(clusterCnf.Url); nil != err {
+				return nil, err
+			}
+		}
+
+		cluster, err := newCluster(ctx, client, cnf, clusterCnf, counters, hooks)
+		if nil != err {
+			return nil, err
+		}
+
+		clusters = append(clusters, cluster)
+	}
+
+	if 0 == len(clusters) {
+		return nil, fmt.Errorf("no elastic search cluster configured")
+	}
+
+	return clusters, nil
+}
+
+func newCluster(ctx context.Context, client *elastic.Client, cnf *Config, clusterCnf ClusterConfig, counters *Counters, hooks processorHooks) (*Cluster, error) {
+	var bp *backpressure
+	if cnf.Listener.Backpressure.Enabled {
+		bp = newBackpressure(clusterCnf.Name, cnf, counters)
+	}
+
+	processor, err := newProcessor(ctx, client, cnf, clusterCnf.Name, counters, bp, hooks)
+	if nil != err {
+		return nil, err
+	}
+
+	c := &Cluster{
+		Name:      clusterCnf.Name,
+		Default:   clusterCnf.Default,
+		Client:    client,
+		Processor: processor,
+		bp:        bp,
+		ctx:       ctx,
+		pending:   make(chan *Request, cnf.Listener.BufferSize),
+		flushes:   make(chan chan error),
+		done:      make(chan struct{}),
+		tasks:     newTaskTracker(clusterCnf.Name, client, counters, hooks.report),
+		report:    hooks.report,
+		counters:  counters,
+	}
+
+	if cnf.Listener.Breaker.Enabled {
+		c.breaker = newBreaker(clusterCnf.Name, client, cnf, counters)
+		go c.breaker.run(ctx)
+
+		if "" != cnf.Listener.Breaker.SpoolDir {
+			if c.spool, err = newSpool(cnf.Listener.Breaker.SpoolDir, clusterCnf.Name, cnf.Listener.Breaker.SpoolMaxBytes); nil != err {
+				return nil, err
+			}
+		}
+	}
+
+	go c.tasks.run(ctx)
+
+	if cnf.Listener.Coalesce {
+		c.coalescer = newCoalescer(processor, cnf.Listener.BufferSize, cnf.Listener.FlushInterval, counters)
+		go c.coalescer.run(ctx)
+	}
+
+	go c.run(ctx)
+
+	return c, nil
+}
+
+func (c *Cluster) run(ctx context.Context) {
+	defer close(c.done)
+
+	// requests spooled by previous run.
+	c.replay()
+
+	for {
+		select {
+		case req, ok := <-c.pending:
+			if !ok {
+				return
+			}
+
+			c.process(ctx, req)
+
+		case done := <-c.flushes:
+			done <- c.flush(ctx)
+
+		case <-c.breaker.recoveries():
+			c.replay()
+		}
+	}
+}
+
+// flush writes buffered requests to the cluster, including all requests
+// which are pending in buffer of the cluster.
+func (c *Cluster) flush(ctx context.Context) error {
+	for drained := false; !drained; {
+		select {
+		case req, ok := <-c.pending:
+			if drained = !ok; ok {
+				c.process(ctx, req)
+			}
+
+		default:
+			drained = true
+		}
+	}
+
+	if nil != c.coalescer {
+		c.coalescer.Flush()
+	}
+
+	return c.Processor.Flush()
+}
+
+func (c *Cluster) process(ctx context.Context, req *Request) {
+	if c.breaker.isOpen() {
+		if nil != c.spool {
+			err := c.spool.write(req)
+			if nil == err {
+				c.counters.Add("cluster."+c.Name+".spooled", 1)
+
+				return
+			}
+
+			logrus.WithError(err).WithField("cluster", c.Name).Errorln("failed to spool request")
+		}
+
+		c.breaker.wait(ctx)
+	}
+
+	// slow down writing to the throughput target, requests to other clusters
+	// are not held meanwhile.
+	c.bp.throttle(ctx)
+
+	// spooled requests are written first, to keep the order.
+	c.replay()
+	c.add(ctx, req)
+}
+
+func (c *Cluster) replay() {
+	if 0 == c.spool.len() || c.breaker.isOpen() {
+		return
+	}
+
+	err := c.spool.replay(func(req *Request) {
+		c.add(context.Background(), req)
+		c.counters.Add("cluster."+c.Name+".replayed", 1)
+	})
+
+	if nil != err {
+		logrus.WithError(err).WithField("cluster", c.Name).Errorln("failed to replay spool")
+	}
+}
+
+func (c *Cluster) add(ctx context.Context, req *Request) {
+	switch {
+	case req.isAdmin(), req.isByQuery():
+		c.execute(ctx, req)
+
+	case nil != c.coalescer:
+		c.coalescer.Add(req)
+
+	default:
+		c.Processor.Add(*req)
+	}
+
+	// batch is full at effective size of backpressure.
+	if nil != c.bp && !req.isAdmin() && !req.isByQuery() && c.bp.add() {
+		if nil != c.coalescer {
+			c.coalescer.Flush()
+		}
+
+		_ = c.Processor.Flush()
+	}
+}
+
+// execute runs request which is not bulk-able, after all requests written
+// before it are flushed.
+func (c *Cluster) execute(ctx context.Context, req *Request) {
+	if nil != c.coalescer {
+		c.coalescer.Flush()
+	}
+
+	_ = c.Processor.Flush()
+
+	var err error
+	if req.isByQuery() {
+		err = c.tasks.start(ctx, req)
+	} else if err = executeAdmin(ctx, c.Client, req); nil == err {
+		c.counters.Add("cluster."+c.Name+".admin.executed", 1)
+	}
+
+	if nil == err {
+		return
+	}
+
+	c.counters.Add("cluster."+c.Name+"."+req.Type+".failed", 1)
+	logrus.
+		WithError(err).
+		WithField("cluster", c.Name).
+		WithField("type", req.Type).
+		Errorln("failed to execute request")
+
+	// request is already dequeued, it's only kept by the error.
+	if nil != c.report {
+		raw, _ := json.Marshal(req)
+		c.report(&ElasticError{Raw: string(raw), Cluster: c.Name, Err: fmt.Errorf("failed to execute %s: %s", req.Type, err)})
+	}
+}
+
+// offer buffers the request for the cluster if there's room for it, without
+// waiting for the cluster. While its circuit breaker is open, requests are
+// spooled or held by the cluster's own goroutine, see process.
+func (c *Cluster) offer(req *Request) (bool, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return false, &RetryError{Err: &ElasticError{Cluster: c.Name, Err: fmt.Errorf("cluster is closed")}}
+	}
+
+	select {
+	case c.pending <- req:
+		return true, nil
+
+	default:
+		return false, nil
+	}
+}
+
+// write buffers the request for the cluster. The request is already dequeued,
+// when the buffer is full it waits for the cluster to catch up.
+func (c *Cluster) write(req *Request) error {
+	if sent, err := c.offer(req); sent || nil != err {
+		return err
+	}
+
+	c.counters.Add("cluster."+c.Name+".full", 1)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.closed {
+		return &RetryError{Err: &ElasticError{Cluster: c.Name, Err: fmt.Errorf("cluster is closed")}}
+	}
+
+	select {
+	case c.pending <- req:
+		return nil
+
+	case <-c.ctx.Done():
+		return &RetryError{Err: &ElasticError{Cluster: c.Name, Err: fmt.Errorf("cluster is stopped, buffer is full")}}
+	}
+}
+
+// Flush writes all requests buffered before it's called to the cluster,
+// without closing it.
+func (c *Cluster) Flush(ctx context.Context) error {
+	done := make(chan error, 1)
+	select {
+	case c.flushes <- done:
+	case <-c.done:
+		return nil // closed, all requests are flushed.
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close writes all buffered requests then closes the bulk processor.
+func (c *Cluster) Close() error {
+	c.breaker.shutdown()
+	c.bp.shutdown()
+
+	c.mu.Lock()
+	if !c.closed {
+		c.closed = true
+		close(c.pending)
+	}
+	c.mu.Unlock()
+
+	<-c.done
+	if nil != c.coalescer {
+		c.coalescer.Flush()
+	}
+
+	return c.Processor.Close()
+}
+
+func (cs Clusters) get(name string) *Cluster {
+	for _, c := range cs {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func (cs Clusters) Names() []string {
+	names := make([]string, len(cs))
+	for i, c := range cs {
+		names[i] = c.Name
+	}
+
+	return names
+}
+
+// targets returns the clusters to write to: the routed one, or all default clusters.
+func (cs Clusters) targets(name string) Clusters {
+	if "" != name {
+		if c := cs.get(name); nil != c {
+			return Clusters{c}
+		}
+
+		return nil
+	}
+
+	targets := Clusters{}
+	for _, c := range cs {
+		if c.Default {
+			targets = append(targets, c)
+		}
+	}
+
+	return targets
+}
+
+// write sends the request to its clusters, failure of one cluster doesn't stop
+// the request from being written to the others.
+func (cs Clusters) write(req *Request) error {
+	if nil == req {
+		return nil
+	}
+
+	targets := cs.targets(req.cluster)
+	if 0 == len(targets) {
+		return fmt.Errorf("no cluster to write request to: %q", req.cluster)
+	}
+
+	// healthy clusters receive the request before waiting for the others.
+	waiting := Clusters{}
+	errs := []error{}
+	for _, c := range targets {
+		if sent, err := c.offer(req); nil != err {
+			errs = append(errs, err)
+		} else if !sent {
+			waiting = append(waiting, c)
+		}
+	}
+
+	for _, c := range waiting {
+		if err := c.write(req); nil != err {
+			errs = append(errs, err)
+		}
+	}
+
+	return joinErrors(errs)
+}
+
+// joinErrors returns single error as is, multiple errors are joined. Request
+// is retried when writing to any of writers can be retried, otherwise it's
+// rejected when any of writers rejects it.
+func joinErrors(errs []error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+
+	case 1:
+		return errs[0]
+	}
+
+	retry, rejected := false, false
+	messages := []string{}
+	for _, err := range errs {
+		switch err.(type) {
+		case *RetryError:
+			retry = true
+
+		case *ValidationError:
+			rejected = true
+		}
+
+		messages = append(messages, err.Error())
+	}
+
+	err := fmt.Errorf("%s", strings.Join(messages, "; "))
+	if retry {
+		return &RetryError{Err: err}
+	}
+
+	if rejected {
+		return reject(err)
+	}
+
+	return err
+}
+
+func (cs Clusters) Stats() map[string]elastic.BulkProcessorStats {
+	stats := map[string]elastic.BulkProcessorStats{}
+	for _, c := range cs {
+		stats[c.Name] = c.Processor.Stats()
+	}
+
+	return stats
+}
+
+// Backpressure returns state of adaptive backpressure of clusters where it's enabled.
+func (cs Clusters) Backpressure() map[string]BackpressureStats {
+	stats := map[string]BackpressureStats{}
+	for _, c := range cs {
+		if nil != c.bp {
+			stats[c.Name] = c.bp.stats()
+		}
+	}
+
+	return stats
+}
+
+// Breakers returns state of circuit breakers of clusters where they are enabled.
+func (cs Clusters) Breakers() map[string]BreakerStats {
+	stats := map[string]BreakerStats{}
+	for _, c := range cs {
+		if nil != c.breaker {
+			breakerStats := c.breaker.stats()
+			breakerStats.Spooled = c.spool.len()
+			stats[c.Name] = breakerStats
+		}
+	}
+
+	return stats
+}
+
+// Tasks returns by-query tasks started on all clusters.
+func (cs Clusters) Tasks() []Task {
+	tasks := []Task{}
+	for _, c := range cs {
+		tasks = append(tasks, c.tasks.list()...)
+	}
+
+	return tasks
+}
+
+// Flush writes buffered requests to all clusters.
+func (cs Clusters) Flush(ctx context.Context) error {
+	failures := []string{}
+	for _, c := range cs {
+		if err := c.Flush(ctx); nil != err {
+			failures = append(failures, fmt.Sprintf("cluster %s: %s", c.Name, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+func (cs Clusters) Close() error {
+	var err error
+	for _, c := range cs {
+		if closeErr := c.Close(); nil != closeErr {
+			err = closeErr
+		}
+	}
+
+	return err
+}
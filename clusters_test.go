@@ -0,0 +1,111 @@
+package redes_writer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClusters_Write(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	counters := NewCounters()
+	es7 := &Cluster{Name: "es7", Default: true, ctx: ctx, pending: make(chan *Request, 1), counters: counters}
+	es8 := &Cluster{Name: "es8", Default: true, ctx: ctx, pending: make(chan *Request, 2), counters: counters}
+	archive := &Cluster{Name: "archive", ctx: ctx, pending: make(chan *Request, 2), counters: counters}
+	clusters := Clusters{es7, es8, archive}
+
+	r1, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {}}}`)
+	r2, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "2", "doc": {}}}`)
+
+	// mirrored to all default clusters
+	assert.NoError(t, clusters.write(r1))
+	assert.Len(t, es7.pending, 1)
+	assert.Len(t, es8.pending, 1)
+	assert.Len(t, archive.pending, 0)
+
+	// es7 is falling behind: es8 still receives the request, es7 receives it
+	// once it catches up.
+	written := make(chan error)
+	go func() { written <- clusters.write(r2) }()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, es8.pending, 2)
+	assert.Equal(t, int64(1), counters.Get("cluster.es7.full"))
+	assert.Equal(t, r1, <-es7.pending)
+	assert.NoError(t, <-written)
+	assert.Equal(t, r2, <-es7.pending)
+
+	// routed request
+	r2.cluster = "archive"
+	assert.NoError(t, clusters.write(r2))
+	assert.Len(t, archive.pending, 1)
+
+	r2.cluster = "unknown"
+	assert.Error(t, clusters.write(r2))
+}
+
+func TestCluster_WriteNeverDrops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &Cluster{Name: "es7", Default: true, ctx: ctx, pending: make(chan *Request, 1), counters: NewCounters()}
+
+	// buffer is full, then es-writer gives up while waiting: request must be
+	// put back to the queue.
+	assert.NoError(t, c.write(&Request{Type: "delete"}))
+	written := make(chan error)
+	go func() { written <- c.write(&Request{Type: "delete"}) }()
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	err := <-written
+	assert.IsType(t, &RetryError{}, err)
+
+	// closed cluster.
+	c.closed = true
+	_, err = c.offer(&Request{Type: "delete"})
+	assert.IsType(t, &RetryError{}, err)
+	assert.IsType(t, &RetryError{}, Clusters{c, c}.write(&Request{Type: "delete"}), "mirrored write is retried")
+}
+
+func TestCluster_ExecuteFailed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"error": {"type": "index_not_found_exception", "reason": "no such index [tmp-1]"}, "status": 404}`)
+	}))
+
+	defer server.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	counters := NewCounters()
+	reported := []error{}
+	processor, _ := client.BulkProcessor().Do(context.Background())
+	defer processor.Close()
+
+	c := &Cluster{Name: "es7", Client: client, Processor: processor, counters: counters, report: func(err error) { reported = append(reported, err) }}
+	req, _ := fromBytes(`{"type": "delete_index", "delete_index": {"index": "tmp-1"}}`)
+	c.execute(context.Background(), req)
+
+	assert.Equal(t, int64(1), counters.Get("cluster.es7.delete_index.failed"))
+	if assert.Len(t, reported, 1) {
+		elasticErr, ok := reported[0].(*ElasticError)
+		assert.True(t, ok)
+		assert.Equal(t, "es7", elasticErr.Cluster)
+		assert.Contains(t, elasticErr.Error(), "failed to execute delete_index")
+
+		// raw message is kept for /errors.
+		raw, _ := fromBytes(elasticErr.RawMessage())
+		assert.Equal(t, "tmp-1", raw.DeleteIndex.Index)
+	}
+}
@@ -2,12 +2,10 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"net/http"
 
-	"github.com/olivere/elastic/v7"
 	"github.com/sirupsen/logrus"
 
 	. "github.com/andytruong/redes-writer"
@@ -15,6 +13,7 @@ import (
 
 func main() {
 	cnfFile := flag.String("c", "", "")
+	dryRun := flag.Bool("dry-run", false, "print changes to indices, templates & ILM policies, without applying them")
 	flag.Parse()
 
 	ctx, stop := context.WithCancel(context.Background())
@@ -25,48 +24,58 @@ func main() {
 		logrus.WithError(err).Panic("can not read config file")
 	}
 
-	processor, queue, errCh, err := Run(ctx, *cnfFile)
+	if *dryRun {
+		changes, err := BootstrapIndices(ctx, cnf, true)
+		if err != nil {
+			logrus.WithError(err).Panic("can not compare indices")
+		}
+
+		reindex := 0
+		for _, change := range changes {
+			fmt.Println(change.String())
+			if "reindex" == change.Action {
+				reindex++
+			}
+		}
+
+		fmt.Printf("%d change(s) to apply, %d requiring reindex\n", len(changes)-reindex, reindex)
+
+		return
+	}
+
+	engine, err := NewEngineFromConfig(cnf)
 	if err != nil {
+		logrus.WithError(err).Panic("invalid config")
+	}
+
+	engine.OnError(func(err Error) {
+		entry := logrus.WithError(err).WithField("severity", err.Severity().String())
+		if SeverityFatal != err.Severity() {
+			entry.Warnln("failed to process message")
+
+			return
+		}
+
+		go func() {
+			_ = engine.Stop(context.Background())
+			entry.Panic("es-writer is broken")
+		}()
+	})
+
+	if err := engine.Start(ctx); err != nil {
 		logrus.WithError(err).Panic("startup error")
 	}
 
-	go func() {
-		_ = processor.Close()
-		panic(<-errCh)
-	}()
+	adminUrl := cnf.Admin.Url
+	if "" == adminUrl {
+		adminUrl = DefaultAdminUrl
+	}
 
-	http.HandleFunc("/stats", getStatsHandler(processor, queue))
 	logrus.
-		WithField("port", cnf.Admin.Url).
+		WithField("port", adminUrl).
 		Println("es-writer admin ready")
 
 	logrus.
-		WithError(http.ListenAndServe(cnf.Admin.Url, nil)).
+		WithError(http.ListenAndServe(adminUrl, NewAdminHandler(engine))).
 		Panic()
 }
-
-func getStatsHandler(processor *elastic.BulkProcessor, queue Queue) http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		type Stats struct {
-			Processor      elastic.BulkProcessorStats `json:"processor"`
-			QueueName      string                     `json:"queueName"`
-			QueueTotalItem int64                      `json:"queueTotalItem"`
-		}
-
-		stats := Stats{
-			Processor:      processor.Stats(),
-			QueueName:      queue.Name(),
-			QueueTotalItem: queue.CountItems(),
-		}
-
-		if stats, err := json.Marshal(stats); err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(500)
-			_, _ = fmt.Fprintln(w, `{"error": "failed to parse statistics."}`)
-		} else {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(200)
-			_, _ = w.Write(stats)
-		}
-	}
-}
@@ -0,0 +1,173 @@
+package redes_writer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+// bulkAdder is the part of elastic.BulkProcessor used by coalescer,
+// make this an interface so that we can test without real elastic-search server.
+type bulkAdder interface {
+	Add(request elastic.BulkableRequest)
+}
+
+// coalescer buffers requests in front of the bulk processor during one flush
+// window, so that many requests to the same document cost a single bulk item:
+//
+// - consecutive partial updates (doc only) are merged into one update.
+// - index then delete is collapsed into delete.
+type coalescer struct {
+	mu       sync.Mutex
+	target   bulkAdder
+	size     int
+	interval time.Duration
+	counters *Counters
+	pending  []*Request
+	last     map[string]int // document key -> position in pending
+}
+
+func newCoalescer(target bulkAdder, size int, interval time.Duration, counters *Counters) *coalescer {
+	return &coalescer{
+		target:   target,
+		size:     size,
+		interval: interval,
+		counters: counters,
+		last:     map[string]int{},
+	}
+}
+
+func (c *coalescer) Add(req *Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := req.key()
+	if pos, ok := c.last[key]; ok && "" != key {
+		if merged := coalesce(c.pending[pos], req); nil != merged {
+			c.pending[pos] = merged
+			c.counters.Add("coalescer.saved", 1)
+
+			return
+		}
+	}
+
+	c.pending = append(c.pending, req)
+	if "" != key {
+		c.last[key] = len(c.pending) - 1
+	}
+
+	if c.size > 0 && len(c.pending) >= c.size {
+		c.flush()
+	}
+}
+
+// Flush sends all pending requests to the bulk processor.
+func (c *coalescer) Flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.flush()
+}
+
+func (c *coalescer) flush() {
+	for _, req := range c.pending {
+		c.target.Add(*req)
+	}
+
+	c.pending = nil
+	c.last = map[string]int{}
+}
+
+// run flushes the pending requests every interval, until ctx is cancelled.
+func (c *coalescer) run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			c.Flush()
+			return
+
+		case <-ticker.C:
+			c.Flush()
+		}
+	}
+}
+
+// coalesce returns single request which has same effect as prev followed by next,
+// or nil if they can't be combined.
+func coalesce(prev *Request, next *Request) *Request {
+	switch {
+	case "index" == prev.Type && "delete" == next.Type:
+		merged := *next
+		merged.idempotencyKeys = mergeKeys(prev, next)
+
+		return &merged
+
+	case "update" == prev.Type && "update" == next.Type:
+		if !isPartialUpdate(prev.Update) || !isPartialUpdate(next.Update) {
+			return nil
+		}
+
+		if !reflect.DeepEqual(prev.Update.DocAsUpsert, next.Update.DocAsUpsert) ||
+			!reflect.DeepEqual(prev.Update.DetectNoop, next.Update.DetectNoop) ||
+			!reflect.DeepEqual(prev.Update.RetryOnConflict, next.Update.RetryOnConflict) {
+			return nil
+		}
+
+		prevDoc, ok := prev.Update.Doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		nextDoc, ok := next.Update.Doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		merged := *next
+		merged.Update.Doc = mergeDocs(prevDoc, nextDoc)
+		merged.idempotencyKeys = mergeKeys(prev, next)
+
+		return &merged
+	}
+
+	return nil
+}
+
+// mergeKeys returns idempotency keys of both requests, merged request is
+// written for both.
+func mergeKeys(prev *Request, next *Request) []string {
+	return append(append([]string{}, prev.idempotencyKeys...), next.idempotencyKeys...)
+}
+
+// partial update is an update which only carries a doc, without script,
+// upsert document or version constraint.
+func isPartialUpdate(u Update) bool {
+	return nil != u.Doc && nil == u.Script && nil == u.Upsert && nil == u.Version
+}
+
+// mergeDocs merges next into a copy of prev, the same way Elastic Search merges
+// partial documents: objects are merged recursively, other values are replaced.
+func mergeDocs(prev map[string]interface{}, next map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(prev)+len(next))
+	for k, v := range prev {
+		merged[k] = v
+	}
+
+	for k, v := range next {
+		prevObject, prevOk := merged[k].(map[string]interface{})
+		nextObject, nextOk := v.(map[string]interface{})
+		if prevOk && nextOk {
+			merged[k] = mergeDocs(prevObject, nextObject)
+		} else {
+			merged[k] = v
+		}
+	}
+
+	return merged
+}
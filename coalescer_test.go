@@ -0,0 +1,73 @@
+package redes_writer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+type adderRecorder struct {
+	requests []string
+}
+
+func (r *adderRecorder) Add(req elastic.BulkableRequest) {
+	r.requests = append(r.requests, req.String())
+}
+
+func TestCoalescer(t *testing.T) {
+	counters := NewCounters()
+	recorder := &adderRecorder{}
+	c := newCoalescer(recorder, 100, time.Second, counters)
+
+	u1, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "123", "routing": "456", "doc": {"field1": "value1", "obj": {"a": 1}}}}`)
+	u2, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "123", "routing": "456", "doc": {"field2": "value2", "obj": {"b": 2}}}}`)
+	u3, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "123", "routing": "789", "doc": {"field3": "value3"}}}`)
+	i1, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "999", "doc": {"field1": "value1"}}}`)
+	d1, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "999"}}`)
+
+	c.Add(u1)
+	c.Add(u2)
+	c.Add(u3)
+	c.Add(i1)
+	c.Add(d1)
+	assert.Empty(t, recorder.requests)
+
+	c.Flush()
+	assert.Equal(t, int64(2), counters.Get("coalescer.saved"))
+	assert.Len(t, recorder.requests, 3)
+	assert.Contains(t, recorder.requests[0], `{"doc":{"field1":"value1","field2":"value2","obj":{"a":1,"b":2}}}`)
+	assert.Contains(t, recorder.requests[1], `"routing":"789"`)
+	assert.Contains(t, recorder.requests[2], `{"delete":{"_index":"lr","_id":"999"}}`)
+
+	// nothing left after flushing
+	c.Flush()
+	assert.Len(t, recorder.requests, 3)
+}
+
+func TestCoalescer_NotMergeable(t *testing.T) {
+	counters := NewCounters()
+	recorder := &adderRecorder{}
+	c := newCoalescer(recorder, 2, time.Second, counters)
+
+	u1, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "123", "doc": {"field1": "value1"}}}`)
+	u2, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "123", "doc": {"field2": "value2"}, "upsert": {"field2": "value2"}}}`)
+
+	c.Add(u1)
+	c.Add(u2)
+
+	// buffer is full, flushed without waiting for the interval
+	assert.Len(t, recorder.requests, 2)
+	assert.Equal(t, int64(0), counters.Get("coalescer.saved"))
+}
+
+func TestCoalesce_IdempotencyKeys(t *testing.T) {
+	i1 := &Request{Type: "index", Index: Index{Index: "lr", Id: "1"}, idempotencyKeys: []string{"k1"}}
+	d1 := &Request{Type: "delete", Delete: Delete{Index: "lr", Id: "1"}, idempotencyKeys: []string{"k2"}}
+
+	// merged request is applied for both, or failed for both.
+	merged := coalesce(i1, d1)
+	assert.Equal(t, []string{"k1", "k2"}, merged.idempotencyKeys)
+	assert.Equal(t, []string{"k2"}, d1.idempotencyKeys)
+}
@@ -10,19 +10,222 @@ import (
 // configuration required to run services in interface.go
 type Config struct {
 	Admin struct {
-		Url string `yaml:"url"`
+		Url string `yaml:"url"` // default 127.0.0.1:8484
+
+		// required as "Authorization: Bearer <token>" by /listener endpoints &
+		// /events, without it they're only served to clients on localhost.
+		Token string `yaml:"token"`
+
+		// number of recent errors kept for /errors, default 100.
+		RecentErrors int `yaml:"recentErrors"`
 	} `yaml:"admin"`
 	Redis struct {
 		Url       string `yaml:"url"`
 		QueueName string `yaml:"queueName"`
+
+		// how long idempotency keys of applied requests are remembered.
+		IdempotencyTTL time.Duration `yaml:"idempotencyTTL"`
 	} `yaml:"redis"`
 	Listener struct {
 		BufferSize    int           `yaml:"bufferSize"`
 		FlushInterval time.Duration `yaml:"flushInterval"`
+
+		// bulk is flushed when it has this many requests, default 1000.
+		BulkActions int `yaml:"bulkActions"`
+
+		// bulk is flushed when it's larger than this many bytes, default 5MB.
+		// Keep it under http.max_content_length of Elastic Search.
+		BulkSize int `yaml:"bulkSize"`
+
+		// number of bulks sent concurrently, default 1. With more workers,
+		// requests to same document may be applied out of order.
+		Workers int `yaml:"workers"`
+
+		// requests larger than this many bytes are rejected, 0 for no limit.
+		MaxDocumentSize int `yaml:"maxDocumentSize"`
+
+		// merge requests to same document inside one flush interval before
+		// sending them to the bulk processor.
+		Coalesce bool `yaml:"coalesce"`
+
+		// time zone used to resolve templated & date math index names, default is UTC.
+		TimeZone string `yaml:"timeZone"`
+
+		// requests are only written to sinks, never to Elastic Search; stdout
+		// sink is used when no sink is configured.
+		DryRun bool `yaml:"dryRun"`
+
+		// glob patterns of indices which can be deleted by delete_index requests, or
+		// whose documents can be deleted by delete_by_query requests. Every index
+		// of comma separated lists must match, wildcards & _all of requests must
+		// be listed as is.
+		DeletableIndices []string `yaml:"deletableIndices"`
+
+		// shrink batches & slow dequeueing when Elastic Search is overloaded.
+		Backpressure struct {
+			Enabled    bool          `yaml:"enabled"`
+			MaxLatency time.Duration `yaml:"maxLatency"` // slower bulks mean overload, default 5s
+			MinBatch   int           `yaml:"minBatch"`   // default 10 requests
+			MaxRate    float64       `yaml:"maxRate"`    // requests per second per cluster, default 5000
+		} `yaml:"backpressure"`
+
+		// hold writing to a cluster while its health checks fail: requests are
+		// spooled, or buffered until the buffer is full, then dequeueing stops.
+		// Other clusters keep receiving requests.
+		Breaker struct {
+			Enabled       bool          `yaml:"enabled"`
+			Interval      time.Duration `yaml:"interval"`      // of health checks, default 5s
+			Failures      int           `yaml:"failures"`      // consecutive failed checks to open, default 3
+			SpoolDir      string        `yaml:"spoolDir"`      // optional, keeps already dequeued requests on disk
+			SpoolMaxBytes int64         `yaml:"spoolMaxBytes"` // per cluster, default 100MB
+		} `yaml:"breaker"`
 	} `yaml:"listener"`
 	ElasticSearch struct {
-		Url string `yaml:"url"`
+		Url string `yaml:"url"` // the "default" cluster
+
+		// more clusters, for example to dual-write during migration.
+		Clusters []ClusterConfig `yaml:"clusters" ignored:"true"`
 	} `yaml:"elasticsearch"`
+
+	// rules to rewrite requests before writing, first matching route wins.
+	Routes []RouteConfig `yaml:"routes" ignored:"true"`
+
+	// transformations applied to documents before writing, in order.
+	Transforms []TransformConfig `yaml:"transforms" ignored:"true"`
+
+	// fields which must never be written unmasked.
+	Redactions []RedactionConfig `yaml:"redactions" ignored:"true"`
+
+	// JSON schemas which documents must conform to, invalid requests are rejected.
+	Schemas []SchemaConfig `yaml:"schemas" ignored:"true"`
+
+	// indices, index templates & ILM policies applied at startup.
+	Indices IndicesConfig `yaml:"indices" ignored:"true"`
+
+	// producers which sign their messages, and what they are allowed to write.
+	Auth struct {
+		// reject messages which are not signed by a known producer.
+		Required  bool             `yaml:"required"`
+		Producers []ProducerConfig `yaml:"producers" ignored:"true"`
+	} `yaml:"auth"`
+
+	// write requests to other sinks, in addition to Elastic Search. Without
+	// elasticsearch section, requests are only written to the sinks.
+	Sinks []SinkConfig `yaml:"sinks" ignored:"true"`
+
+	// middlewares around the writer, in order: logging, metrics, filter & sample.
+	Middlewares []MiddlewareConfig `yaml:"middlewares" ignored:"true"`
+
+	// token buckets limiting how fast requests of an index or producer are written.
+	RateLimits []RateLimitConfig `yaml:"rateLimits" ignored:"true"`
+}
+
+type ClusterConfig struct {
+	Name string `yaml:"name"`
+	Url  string `yaml:"url"`
+
+	// requests which are not routed to a specific cluster are written to all
+	// default clusters.
+	Default bool `yaml:"default"`
+}
+
+type RouteConfig struct {
+	Match MatchConfig `yaml:"match"`
+
+	Cluster  string `yaml:"cluster"`  // target Elastic Search cluster
+	Index    string `yaml:"index"`    // new index name
+	Pipeline string `yaml:"pipeline"` // ingest pipeline, for index requests
+
+	// reject deletes & updates to the matched index without the matched field,
+	// instead of writing them to the source index, when all documents with the
+	// field are routed.
+	RejectUnresolved bool `yaml:"rejectUnresolved"`
+}
+
+// MatchConfig selects requests, empty conditions match all requests.
+type MatchConfig struct {
+	Index string `yaml:"index"` // glob pattern of index name, e.g. "lr-*"
+	Type  string `yaml:"type"`  // request type: index, update or delete
+	Field string `yaml:"field"` // dotted path of field in document
+	Value string `yaml:"value"` // expected value of the field
+}
+
+type RedactionConfig struct {
+	Name   string   `yaml:"name"`   // name of the policy, used in statistics
+	Index  string   `yaml:"index"`  // glob pattern of index name, empty for all indices
+	Paths  []string `yaml:"paths"`  // e.g. "$.user.email", "$.phones[*]"
+	Action string   `yaml:"action"` // mask (default), hash or remove
+	Key    string   `yaml:"key"`    // HMAC-SHA256 key of hash action, e.g. "${REDACTION_KEY}"
+}
+
+type SchemaConfig struct {
+	Index  string      `yaml:"index"`  // glob pattern of index name, empty for all indices
+	File   string      `yaml:"file"`   // path to JSON schema file
+	Schema interface{} `yaml:"schema"` // or inline schema, when file is empty
+}
+
+type ProducerConfig struct {
+	Name    string   `yaml:"name"`
+	Key     string   `yaml:"key"`     // HMAC-SHA256 key, e.g. "${BILLING_PRODUCER_KEY}"
+	Indices []string `yaml:"indices"` // glob patterns of writable indices, empty for all indices
+	Types   []string `yaml:"types"`   // allowed request types, empty for all types
+}
+
+type RateLimitConfig struct {
+	Name     string  `yaml:"name"`     // name of the limit, used in statistics
+	Index    string  `yaml:"index"`    // glob pattern of index name, empty for all indices
+	Producer string  `yaml:"producer"` // name of producer, empty for all producers
+	Rate     float64 `yaml:"rate"`     // requests per second
+	Burst    int     `yaml:"burst"`    // default is rate, at least 1
+}
+
+type MiddlewareConfig struct {
+	Type  string      `yaml:"type"`  // logging, metrics, filter or sample
+	Name  string      `yaml:"name"`  // used in statistics, default is type
+	Match MatchConfig `yaml:"match"` // requests handled by the middleware, all when empty
+	Level string      `yaml:"level"` // logging: debug (default), info or warn
+	Rate  float64     `yaml:"rate"`  // sample: fraction of requests to keep, e.g. 0.1
+}
+
+type SinkConfig struct {
+	Name string `yaml:"name"` // used in statistics, default is type
+	Type string `yaml:"type"` // file, stdout or webhook
+
+	// file: NDJSON file, rotated when larger than maxBytes (default 100MB),
+	// maxFiles (default 5) rotated files are kept.
+	Path     string `yaml:"path"`
+	MaxBytes int64  `yaml:"maxBytes"`
+	MaxFiles int    `yaml:"maxFiles"`
+
+	// webhook: each request is posted as JSON to url, in background. Writing
+	// fails when buffer (default 1000) requests are waiting to be posted.
+	Url     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+	Timeout time.Duration     `yaml:"timeout"` // default 10s
+	Buffer  int               `yaml:"buffer"`
+}
+
+type IndicesConfig struct {
+	Policies  []IlmPolicyConfig     `yaml:"policies"`
+	Templates []IndexTemplateConfig `yaml:"templates"`
+	Indices   []IndexConfig         `yaml:"indices"`
+}
+
+type IlmPolicyConfig struct {
+	Name   string      `yaml:"name"`
+	Policy interface{} `yaml:"policy"` // e.g. {phases: {delete: {min_age: 30d, actions: {delete: {}}}}}
+}
+
+type IndexTemplateConfig struct {
+	Name string      `yaml:"name"`
+	Body interface{} `yaml:"body"` // index_patterns, settings, mappings, aliases, order
+}
+
+type IndexConfig struct {
+	Name     string      `yaml:"name"`
+	Settings interface{} `yaml:"settings"`
+	Mappings interface{} `yaml:"mappings"`
+	Aliases  []string    `yaml:"aliases"`
 }
 
 // NewConfig return configuration required to run services in interface.go
@@ -67,4 +270,27 @@ func setConfigFromEnv(cnf *Config, prefix string) error {
 		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
+type TransformConfig struct {
+	Index string          `yaml:"index"` // glob pattern of index name, empty for all indices
+	Steps []TransformStep `yaml:"steps"`
+}
+
+// TransformStep declares one transformation, fields used depend on the operation:
+//
+//	{op: set, field: source, value: es-writer}
+//	{op: rename, field: old_name, to: new_name}
+//	{op: copy, field: title, to: title_raw}
+//	{op: remove, field: password}
+//	{op: convert, field: age, type: int}                          # int, float, string, bool
+//	{op: timestamp, field: indexed_at, format: "2006-01-02T15:04:05Z07:00"}
+//	{op: hash, field: email, to: email_hash, algorithm: sha256}  # sha256, sha1, md5
+type TransformStep struct {
+	Op        string      `yaml:"op"`
+	Field     string      `yaml:"field"`
+	To        string      `yaml:"to"`
+	Value     interface{} `yaml:"value"`
+	Type      string      `yaml:"type"`
+	Format    string      `yaml:"format"`
+	Algorithm string      `yaml:"algorithm"`
+}
@@ -34,6 +34,10 @@ func TestNewConfig(t *testing.T) {
 	// Listener
 	assert.Equal(500, cnf.Listener.BufferSize)
 	assert.Equal(1*time.Second, cnf.Listener.FlushInterval)
+	assert.Equal(1000, cnf.Listener.BulkActions)
+	assert.Equal(5242880, cnf.Listener.BulkSize)
+	assert.Equal(1, cnf.Listener.Workers)
+	assert.Equal(1048576, cnf.Listener.MaxDocumentSize)
 }
 
 func TestEnvOverride(t *testing.T) {
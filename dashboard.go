@@ -0,0 +1,174 @@
+package redes_writer
+
+// dashboardHTML is the admin dashboard, self-contained so that it works
+// without access to the internet. It polls /stats & /errors.
+const dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>es-writer</title>
+<style>
+  body { font: 14px/1.4 -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; background: #f5f6f8; color: #222; }
+  header { background: #24292e; color: #fff; padding: 12px 24px; display: flex; justify-content: space-between; align-items: baseline; }
+  header h1 { font-size: 18px; margin: 0; }
+  main { padding: 16px 24px; display: grid; grid-template-columns: repeat(auto-fit, minmax(420px, 1fr)); gap: 16px; }
+  section { background: #fff; border: 1px solid #e1e4e8; border-radius: 4px; padding: 12px 16px; }
+  section.wide { grid-column: 1 / -1; }
+  h2 { font-size: 14px; margin: 0 0 8px; color: #586069; text-transform: uppercase; letter-spacing: .04em; }
+  .value { font-size: 28px; font-weight: 600; }
+  svg { width: 100%; height: 120px; display: block; }
+  polyline { fill: none; stroke: #0366d6; stroke-width: 2; }
+  table { width: 100%; border-collapse: collapse; }
+  th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #eaecef; vertical-align: top; }
+  td.num, th.num { text-align: right; font-variant-numeric: tabular-nums; }
+  .warning { color: #b08800; } .error { color: #cb2431; } .fatal { color: #fff; background: #cb2431; }
+  .muted { color: #6a737d; }
+</style>
+</head>
+<body>
+<header>
+  <h1>es-writer <span class="muted" id="queue"></span></h1>
+  <span>listener: <strong id="listener">…</strong> <span class="muted" id="updated"></span></span>
+</header>
+<main>
+  <section>
+    <h2>Queue depth</h2>
+    <div class="value" id="depth">…</div>
+    <svg id="depth-chart" viewBox="0 0 300 100" preserveAspectRatio="none"><polyline points=""/></svg>
+  </section>
+  <section>
+    <h2>Throughput (requests/s)</h2>
+    <div class="value" id="throughput">…</div>
+    <svg id="throughput-chart" viewBox="0 0 300 100" preserveAspectRatio="none"><polyline points=""/></svg>
+  </section>
+  <section>
+    <h2>Failure rate by index</h2>
+    <table>
+      <thead><tr><th>Index</th><th class="num">Written</th><th class="num">Failed</th><th class="num">Failure rate</th></tr></thead>
+      <tbody id="indices"></tbody>
+    </table>
+  </section>
+  <section>
+    <h2>Bulk processor workers</h2>
+    <table>
+      <thead><tr><th>Cluster</th><th class="num">Worker</th><th class="num">Queued</th><th class="num">Last commit</th></tr></thead>
+      <tbody id="workers"></tbody>
+    </table>
+  </section>
+  <section class="wide">
+    <h2>Recent errors</h2>
+    <table>
+      <thead><tr><th>Time</th><th>Severity</th><th>Type</th><th>Index</th><th>ID</th><th>Message</th></tr></thead>
+      <tbody id="errors"></tbody>
+    </table>
+  </section>
+</main>
+<script>
+(function () {
+  var interval = 2000, points = 150, depths = [], throughputs = [], previous = null;
+
+  function text(value) {
+    var span = document.createElement("span");
+    span.textContent = null == value ? "" : String(value);
+    return span.innerHTML;
+  }
+
+  function rows(id, html) {
+    document.getElementById(id).innerHTML = html.length ? html.join("") : '<tr><td colspan="6" class="muted">none</td></tr>';
+  }
+
+  function push(values, value) {
+    values.push(value);
+    if (values.length > points) {
+      values.shift();
+    }
+  }
+
+  function chart(id, values) {
+    var max = Math.max.apply(null, values.concat([1])), step = 300 / (points - 1);
+    var coordinates = values.map(function (value, i) {
+      return ((points - values.length + i) * step).toFixed(1) + "," + (100 - value / max * 95).toFixed(1);
+    });
+
+    document.querySelector("#" + id + " polyline").setAttribute("points", coordinates.join(" "));
+  }
+
+  function succeeded(stats) {
+    var total = 0;
+    Object.keys(stats.clusters || {}).forEach(function (name) {
+      total += stats.clusters[name].Succeeded || 0;
+    });
+
+    return total;
+  }
+
+  function renderStats(stats) {
+    var now = Date.now();
+    document.getElementById("queue").textContent = stats.queueName || "";
+    document.getElementById("listener").textContent = (stats.listener || {}).state || "unknown";
+    document.getElementById("updated").textContent = "updated " + new Date(now).toLocaleTimeString();
+
+    document.getElementById("depth").textContent = stats.queueTotalItem;
+    push(depths, stats.queueTotalItem);
+    chart("depth-chart", depths);
+
+    var current = { time: now, succeeded: succeeded(stats) };
+    if (null !== previous) {
+      var rate = Math.max(0, (current.succeeded - previous.succeeded) / ((current.time - previous.time) / 1000));
+      document.getElementById("throughput").textContent = rate.toFixed(1);
+      push(throughputs, rate);
+      chart("throughput-chart", throughputs);
+    }
+    previous = current;
+
+    var indices = {};
+    Object.keys(stats.counters || {}).forEach(function (key) {
+      var match = /^index\.(.+)\.(written|failed)$/.exec(key);
+      if (match) {
+        indices[match[1]] = indices[match[1]] || { written: 0, failed: 0 };
+        indices[match[1]][match[2]] = stats.counters[key];
+      }
+    });
+
+    rows("indices", Object.keys(indices).sort().map(function (name) {
+      var index = indices[name], total = index.written + index.failed;
+      var rate = total ? index.failed / total * 100 : 0;
+      return "<tr><td>" + text(name) + '</td><td class="num">' + index.written + '</td><td class="num">' + index.failed +
+        '</td><td class="num' + (rate > 0 ? " error" : "") + '">' + rate.toFixed(2) + " %</td></tr>";
+    }));
+
+    var workers = [];
+    Object.keys(stats.clusters || {}).sort().forEach(function (name) {
+      (stats.clusters[name].Workers || []).forEach(function (worker, i) {
+        workers.push("<tr><td>" + text(name) + '</td><td class="num">' + i + '</td><td class="num">' + worker.Queued +
+          '</td><td class="num">' + (worker.LastDuration / 1e6).toFixed(1) + " ms</td></tr>");
+      });
+    });
+    rows("workers", workers);
+  }
+
+  function renderErrors(records) {
+    rows("errors", records.map(function (record) {
+      return "<tr><td>" + text(new Date(record.time).toLocaleTimeString()) + '</td><td class="' + text(record.severity) + '">' +
+        text(record.severity) + "</td><td>" + text(record.type) + "</td><td>" + text(record.index) + "</td><td>" +
+        text(record.id) + "</td><td>" + text(record.message) + "</td></tr>";
+    }));
+  }
+
+  function poll() {
+    Promise.all([
+      fetch("stats").then(function (res) { return res.json(); }).then(renderStats),
+      fetch("errors?limit=20").then(function (res) { return res.json(); }).then(renderErrors)
+    ]).catch(function (err) {
+      document.getElementById("updated").textContent = "failed to update: " + err;
+    }).then(function () {
+      setTimeout(poll, interval);
+    });
+  }
+
+  poll();
+})();
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,108 @@
+package redes_writer
+
+import (
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+// default TTL of idempotency keys, when not configured.
+const defaultIdempotencyTTL = 24 * time.Hour
+
+// deduplicator remembers idempotency keys of applied requests in redis, so that
+// requests retried by producers are not applied twice.
+type deduplicator struct {
+	client   *redis.Client
+	prefix   string
+	ttl      time.Duration
+	counters *Counters
+}
+
+func newDeduplicator(client *redis.Client, queueName string, ttl time.Duration, counters *Counters) *deduplicator {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+
+	return &deduplicator{
+		client:   client,
+		prefix:   queueName + "-idempotency:",
+		ttl:      ttl,
+		counters: counters,
+	}
+}
+
+// wrap returns a writer which skips requests already applied.
+func (d *deduplicator) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil == req || "" == req.IdempotencyKey {
+			return writer(req)
+		}
+
+		key := d.prefix + req.IdempotencyKey
+		fresh, err := d.client.SetNX(key, 1, d.ttl).Result()
+		if nil != err {
+			return err
+		}
+
+		if !fresh {
+			d.counters.Add("dedup.hits", 1)
+
+			return nil
+		}
+
+		// writing may still fail later in the bulk, see forget.
+		req.idempotencyKeys = append(req.idempotencyKeys, key)
+
+		err = writer(req)
+		if nil != err {
+			// not applied, allow producer to retry.
+			d.client.Del(key)
+		}
+
+		return err
+	}
+}
+
+// forget removes idempotency keys of request which Elastic Search failed to
+// apply, so that it's not skipped when producer retries it.
+func (d *deduplicator) forget(req Request) {
+	if 0 == len(req.idempotencyKeys) {
+		return
+	}
+
+	if err := d.client.Del(req.idempotencyKeys...).Err(); nil != err {
+		logrus.WithError(err).Errorln("failed to forget idempotency keys")
+
+		return
+	}
+
+	d.counters.Add("dedup.forgotten", int64(len(req.idempotencyKeys)))
+}
+
+// failedRequests returns requests of a bulk which were not applied, items of
+// response are in order of requests.
+func failedRequests(requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) []Request {
+	failed := []Request{}
+	for i, bulkReq := range requests {
+		req, ok := bulkReq.(Request)
+		if !ok {
+			continue
+		}
+
+		if nil != err || nil == response || i >= len(response.Items) {
+			failed = append(failed, req)
+			continue
+		}
+
+		for _, item := range response.Items[i] {
+			if nil != item.Error {
+				failed = append(failed, req)
+				break
+			}
+		}
+	}
+
+	return failed
+}
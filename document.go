@@ -0,0 +1,124 @@
+package redes_writer
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helpers to access fields of documents decoded from JSON, by dotted path,
+// for example "user.address.city".
+
+func getField(doc interface{}, path string) (interface{}, bool) {
+	current := doc
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+
+		current, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// setField sets value of field, intermediate objects are created when missing.
+func setField(doc map[string]interface{}, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	current := doc
+	for i, key := range keys[:len(keys)-1] {
+		next, ok := current[key]
+		if !ok {
+			next = map[string]interface{}{}
+			current[key] = next
+		}
+
+		object, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("can not set %s: %s is not an object", path, strings.Join(keys[:i+1], "."))
+		}
+
+		current = object
+	}
+
+	current[keys[len(keys)-1]] = value
+
+	return nil
+}
+
+// deleteField removes field from document and returns its old value.
+func deleteField(doc map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	parent, ok := getField(doc, strings.Join(keys[:len(keys)-1], "."))
+	if 1 == len(keys) {
+		parent, ok = doc, true
+	}
+
+	object, isObject := parent.(map[string]interface{})
+	if !ok || !isObject {
+		return nil, false
+	}
+
+	value, ok := object[keys[len(keys)-1]]
+	delete(object, keys[len(keys)-1])
+
+	return value, ok
+}
+
+// normalizeYaml converts objects decoded by yaml (map[interface{}]interface{})
+// into objects which can be encoded as JSON.
+func normalizeYaml(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[fmt.Sprint(key)] = normalizeYaml(item)
+		}
+
+		return object
+
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = normalizeYaml(item)
+		}
+
+		return items
+	}
+
+	return value
+}
+
+// documentSizeLimit rejects requests which are too large to be written, one
+// large document must not make the whole bulk fail.
+type documentSizeLimit struct {
+	max      int // bytes, 0 for no limit
+	counters *Counters
+}
+
+func (l documentSizeLimit) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req && l.max > 0 && ("index" == req.Type || "update" == req.Type) {
+			lines, err := req.Source()
+			if nil != err {
+				return reject(err)
+			}
+
+			size := 0
+			for _, line := range lines {
+				size += len(line) + 1
+			}
+
+			if size > l.max {
+				l.counters.Add("document.oversized", 1)
+
+				return reject(fmt.Errorf("request to %s is %d bytes, larger than limit of %d bytes", req.indexName(), size, l.max))
+			}
+		}
+
+		return writer(req)
+	}
+}
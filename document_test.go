@@ -0,0 +1,33 @@
+package redes_writer
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDocumentSizeLimit(t *testing.T) {
+	counters := NewCounters()
+	written := 0
+	writer := documentSizeLimit{max: 200, counters: counters}.wrap(func(req *Request) error {
+		written++
+
+		return nil
+	})
+
+	small, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"a": "b"}}}`)
+	assert.NoError(t, writer(small))
+
+	large, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"a": "` + strings.Repeat("x", 200) + `"}}}`)
+	err := writer(large)
+	assert.IsType(t, &ValidationError{}, err)
+	assert.Contains(t, err.Error(), "larger than limit of 200 bytes")
+
+	// delete requests have no document.
+	del, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`)
+	assert.NoError(t, writer(del))
+
+	assert.Equal(t, 2, written)
+	assert.Equal(t, int64(1), counters.Get("document.oversized"))
+}
@@ -0,0 +1,526 @@
+package redes_writer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+type (
+	// Options to build an Engine, only Config is required.
+	Options struct {
+		Config *Config
+
+		// default: connect to redis.url of Config.
+		Redis *redis.Client
+
+		// clients by cluster name, default: connect to URL of the cluster.
+		ElasticSearch map[string]*elastic.Client
+
+		// default: new counters, owned by the engine.
+		Counters *Counters
+
+		// written to, in addition to sinks declared in Config.
+		Sinks []Sink
+
+		// around the writer, after middlewares declared in Config.
+		Middlewares []Middleware
+	}
+
+	// Engine reads requests from the queue and writes them to Elastic Search
+	// clusters & sinks, through all stages declared in Config.
+	Engine struct {
+		mu       sync.Mutex
+		cnf      *Config
+		options  Options
+		redis    *redis.Client
+		counters *Counters
+		limiter  *rateLimiter
+		stages   []Middleware
+		sinks    []Sink
+		errCh    chan error // reported by listener
+		errors   *errorHub
+		errLog   *errorLog
+		events   *eventBus
+		dedup    *deduplicator
+		gate     *gate
+		draining int32
+
+		// set by Start.
+		queue        Queue
+		clusters     Clusters
+		listening    chan struct{} // closed when listener stopped
+		stopListener context.CancelFunc
+		stopClusters context.CancelFunc
+		started      bool
+		stopped      bool
+	}
+
+	// Stats of a running engine, as reported on the admin server.
+	Stats struct {
+		Processor      elastic.BulkProcessorStats            `json:"processor"` // of the first cluster
+		Clusters       map[string]elastic.BulkProcessorStats `json:"clusters"`
+		QueueName      string                                `json:"queueName"`
+		QueueTotalItem int64                                 `json:"queueTotalItem"`
+		Counters       map[string]int64                      `json:"counters"`
+		Tasks          []Task                                `json:"tasks"`
+		RateLimits     []RateLimit                           `json:"rateLimits"`
+		Backpressure   map[string]BackpressureStats          `json:"backpressure"`
+		Breakers       map[string]BreakerStats               `json:"breakers"`
+		Listener       ListenerState                         `json:"listener"`
+	}
+
+	// ListenerState tells whether requests are dequeued.
+	ListenerState struct {
+		State    string     `json:"state"` // running, paused or draining
+		PausedAt *time.Time `json:"pausedAt,omitempty"`
+		InFlight int        `json:"inFlight"` // messages popped but not yet processed
+	}
+)
+
+const (
+	ListenerRunning  = "running"
+	ListenerPaused   = "paused"
+	ListenerDraining = "draining"
+)
+
+// NewEngine validates configuration & builds all stages, nothing is started
+// until Start is called.
+func NewEngine(options Options) (*Engine, error) {
+	cnf := options.Config
+	if nil == cnf {
+		return nil, fmt.Errorf("missing config")
+	}
+
+	e := &Engine{
+		cnf:      cnf,
+		options:  options,
+		redis:    options.Redis,
+		counters: options.Counters,
+		errCh:    make(chan error, 64),
+		gate:     newGate(),
+	}
+
+	if nil == e.redis {
+		e.redis = newRedisClient(cnf.Redis.Url)
+	}
+
+	if nil == e.counters {
+		e.counters = NewCounters()
+	}
+
+	e.errors = newErrorHub(100, e.counters)
+	e.errLog = newErrorLog(cnf.Admin.RecentErrors)
+	e.errors.subscribe(e.errLog.add)
+	e.events = newEventBus(e.counters)
+	e.errors.subscribe(e.events.failed)
+
+	var err error
+	if e.limiter, err = newRateLimiter(cnf.RateLimits, e.counters); nil != err {
+		return nil, err
+	}
+
+	if e.stages, err = e.newStages(); nil != err {
+		return nil, err
+	}
+
+	for i, sinkCnf := range cnf.Sinks {
+		sink, err := NewSink(sinkCnf)
+		if nil != err {
+			_ = e.closeSinks()
+
+			return nil, fmt.Errorf("sinks[%d]: %s", i, err)
+		}
+
+		e.sinks = append(e.sinks, sink)
+	}
+
+	e.sinks = append(e.sinks, options.Sinks...)
+
+	// dry run prints requests instead of writing them.
+	if cnf.Listener.DryRun && 0 == len(e.sinks) {
+		e.sinks = append(e.sinks, &stdoutSink{out: os.Stdout})
+	}
+
+	return e, nil
+}
+
+// writesToClusters tells whether requests are written to Elastic Search, it's
+// optional when requests are written to sinks.
+func (e *Engine) writesToClusters() bool {
+	if e.cnf.Listener.DryRun {
+		return false
+	}
+
+	return len(clusterConfigs(e.cnf)) > 0 || 0 == len(e.sinks)
+}
+
+// NewEngineFromConfig builds an Engine with default clients.
+func NewEngineFromConfig(cnf *Config) (*Engine, error) {
+	return NewEngine(Options{Config: cnf})
+}
+
+// newStages builds stages which requests go through before writing, in order.
+func (e *Engine) newStages() ([]Middleware, error) {
+	cnf := e.cnf
+
+	clusterNames := []string{}
+	for _, clusterCnf := range clusterConfigs(cnf) {
+		clusterNames = append(clusterNames, clusterCnf.Name)
+	}
+
+	schemas, err := newSchemaValidator(cnf.Schemas, e.counters)
+	if nil != err {
+		return nil, err
+	}
+
+	redactions, err := newRedactor(cnf.Redactions, e.counters)
+	if nil != err {
+		return nil, err
+	}
+
+	routes, err := newRouter(cnf.Routes, clusterNames)
+	if nil != err {
+		return nil, err
+	}
+
+	transforms, err := newTransformer(cnf.Transforms)
+	if nil != err {
+		return nil, err
+	}
+
+	auth, err := newAuthorizer(cnf.Auth.Required, cnf.Auth.Producers, e.counters)
+	if nil != err {
+		return nil, err
+	}
+
+	indexNames, err := newIndexNameResolver(cnf.Listener.TimeZone)
+	if nil != err {
+		return nil, err
+	}
+
+	middlewares, err := newMiddlewares(cnf.Middlewares, e.counters)
+	if nil != err {
+		return nil, err
+	}
+
+	e.dedup = newDeduplicator(e.redis, cnf.Redis.QueueName, cnf.Redis.IdempotencyTTL, e.counters)
+
+	// configured middlewares are closest to the writer.
+	stages := append([]Middleware{
+		indexNames.wrap,
+		auth.wrap,
+		transforms.wrap,
+		routes.wrap,
+		e.limiter.wrap,  // limits match the final index name.
+		schemas.wrap,    // documents as produced, values are not redacted yet.
+		redactions.wrap, // after all other changes, with the final index name.
+		e.events.wrap,   // redacted requests only.
+		adminGuard{deletable: cnf.Listener.DeletableIndices}.wrap,
+		documentSizeLimit{max: cnf.Listener.MaxDocumentSize, counters: e.counters}.wrap,
+		e.dedup.wrap,
+	}, middlewares...)
+
+	return append(stages, e.options.Middlewares...), nil
+}
+
+// Start connects to the queue & clusters, applies declared indices then starts
+// listening. Listening stops when ctx is cancelled, Stop must still be called
+// to flush buffered requests.
+func (e *Engine) Start(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.started {
+		return fmt.Errorf("engine is already started")
+	}
+
+	queue, err := newQueue(e.redis, e.cnf.Redis.QueueName)
+	if nil != err {
+		return err
+	}
+
+	queue.gate = e.gate
+
+	// bulk processors must outlive listening, to flush on Stop.
+	clustersCtx, stopClusters := context.WithCancel(context.Background())
+
+	clusters := Clusters{}
+	if e.writesToClusters() {
+		hooks := processorHooks{report: e.errors.publish, flushed: e.events.flushed, failed: e.dedup.forget}
+		if clusters, err = newClusters(clustersCtx, e.cnf, e.counters, e.options.ElasticSearch, hooks); nil != err {
+			stopClusters()
+
+			return err
+		}
+	}
+
+	for _, c := range clusters {
+		if _, err := bootstrapIndices(ctx, c.Name, c.Client, e.cnf.Indices, false); nil != err {
+			_ = clusters.Close()
+			stopClusters()
+
+			return err
+		}
+	}
+
+	writers := []Writer{}
+	if len(clusters) > 0 {
+		writers = append(writers, clusters.write)
+	}
+
+	if len(e.sinks) > 0 {
+		names := []string{}
+		for i := range e.sinks {
+			name := fmt.Sprintf("sink%d", i)
+			if i < len(e.cnf.Sinks) {
+				name = e.cnf.Sinks[i].Name
+				if "" == name {
+					name = e.cnf.Sinks[i].Type
+				}
+			}
+
+			names = append(names, name)
+		}
+
+		writers = append(writers, newSinkWriter(e.sinks, names, e.counters))
+	}
+
+	writer := Chain(e.stages...)(fanOut(writers...))
+
+	go func() {
+		for {
+			select {
+			case err := <-e.errCh:
+				e.errors.publish(err)
+
+			case <-clustersCtx.Done():
+				return
+			}
+		}
+	}()
+
+	listenerCtx, stopListener := context.WithCancel(ctx)
+	l := &listener{throttling: len(e.limiter.buckets) > 0, gate: e.gate, done: make(chan struct{})}
+	if err := l.Run(listenerCtx, e.errCh, queue, writer); nil != err {
+		stopListener()
+		_ = clusters.Close()
+		_ = queue.Close()
+		stopClusters()
+
+		return err
+	}
+
+	e.queue, e.clusters, e.listening = queue, clusters, l.done
+	e.stopListener, e.stopClusters = stopListener, stopClusters
+	e.started = true
+
+	logrus.WithField("queue", queue.Name()).Infoln("es-writer engine started")
+
+	return nil
+}
+
+// Stop stops listening, waits for requests which are already dequeued, then
+// flushes buffered requests to clusters & sinks. ctx limits how long to wait:
+// when it's done, requests still waiting for a cluster are put back to the
+// queue.
+func (e *Engine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	if !e.started || e.stopped {
+		e.mu.Unlock()
+
+		return nil
+	}
+
+	e.stopped = true
+	e.mu.Unlock()
+
+	// nothing is dequeued from now.
+	e.gate.pause()
+	e.stopListener()
+
+	done := make(chan error, 1)
+	go func() {
+		<-e.listening
+
+		err := e.clusters.Close()
+		if sinkErr := e.closeSinks(); nil == err {
+			err = sinkErr
+		}
+
+		if closer, ok := e.queue.(io.Closer); ok {
+			if queueErr := closer.Close(); nil == err {
+				err = queueErr
+			}
+		}
+
+		e.stopClusters()
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-ctx.Done():
+		// requests waiting for a cluster are requeued.
+		e.stopClusters()
+
+		return ctx.Err()
+	}
+}
+
+// Pause stops dequeueing, requests stay in the queue until Resume is called.
+// Requests which are already dequeued are still written.
+func (e *Engine) Pause() {
+	e.gate.pause()
+}
+
+// Resume continues dequeueing after Pause or Drain.
+func (e *Engine) Resume() {
+	e.gate.resume()
+}
+
+// Flush writes requests buffered by bulk processors to all clusters.
+func (e *Engine) Flush(ctx context.Context) error {
+	return e.Clusters().Flush(ctx)
+}
+
+// Drain pauses dequeueing, waits for dequeued requests then flushes them, so
+// that nothing is buffered by es-writer. Dequeueing stays paused.
+func (e *Engine) Drain(ctx context.Context) error {
+	atomic.AddInt32(&e.draining, 1)
+	defer atomic.AddInt32(&e.draining, -1)
+
+	e.gate.pause()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !e.gate.idle() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return e.Flush(ctx)
+}
+
+// ListenerState returns whether requests are dequeued.
+func (e *Engine) ListenerState() ListenerState {
+	paused, pausedAt := e.gate.state()
+	state := ListenerState{State: ListenerRunning, InFlight: int(atomic.LoadInt32(&e.gate.inflight))}
+
+	if paused {
+		state.State = ListenerPaused
+		state.PausedAt = &pausedAt
+	}
+
+	if atomic.LoadInt32(&e.draining) > 0 {
+		state.State = ListenerDraining
+	}
+
+	return state
+}
+
+// PeekQueue returns first n pending messages, or last n when tail.
+func (e *Engine) PeekQueue(tail bool, n int) ([]QueueItem, error) {
+	return peekQueue(e.redis, e.cnf.Redis.QueueName, tail, n)
+}
+
+// SummarizeQueue counts pending requests by index & type, of at most sample
+// messages spread through the queue.
+func (e *Engine) SummarizeQueue(sample int) (QueueSummary, error) {
+	return summarizeQueue(e.redis, e.cnf.Redis.QueueName, sample)
+}
+
+// FindInQueue returns pending requests to document id, index is optional.
+// At most scan messages are read, from head of the queue.
+func (e *Engine) FindInQueue(id string, index string, scan int) (QueueSearch, error) {
+	return findInQueue(e.redis, e.cnf.Redis.QueueName, id, index, scan)
+}
+
+func (e *Engine) closeSinks() error {
+	var err error
+	for _, sink := range e.sinks {
+		if closeErr := sink.Close(); nil != closeErr {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// Errors reports errors of listening & writing, as Error values. Errors are
+// dropped when the channel is not consumed fast enough.
+func (e *Engine) Errors() <-chan error {
+	return e.errors.ch
+}
+
+// OnError registers callback which is called with each reported error, it
+// must not block.
+func (e *Engine) OnError(callback func(err Error)) {
+	e.errors.subscribe(callback)
+}
+
+// RecentErrors returns matching errors of the last reported errors, newest
+// first, including items failed by Elastic Search.
+func (e *Engine) RecentErrors(filter ErrorFilter) []ErrorRecord {
+	return e.errLog.list(filter)
+}
+
+// Events streams matching events until cancel is called. Events are dropped
+// when the channel is not consumed fast enough.
+func (e *Engine) Events(filter EventFilter) (<-chan Event, func()) {
+	return e.events.subscribe(filter)
+}
+
+// Counters returns the engine's own statistics.
+func (e *Engine) Counters() *Counters {
+	return e.counters
+}
+
+// Clusters returns the clusters which the engine writes to, after Start.
+func (e *Engine) Clusters() Clusters {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.clusters
+}
+
+func (e *Engine) Stats() Stats {
+	e.mu.Lock()
+	queue, clusters := e.queue, e.clusters
+	e.mu.Unlock()
+
+	stats := Stats{
+		Clusters:     clusters.Stats(),
+		Counters:     e.counters.Snapshot(),
+		Tasks:        clusters.Tasks(),
+		RateLimits:   e.limiter.state(),
+		Backpressure: clusters.Backpressure(),
+		Breakers:     clusters.Breakers(),
+		Listener:     e.ListenerState(),
+	}
+
+	if len(clusters) > 0 {
+		stats.Processor = clusters[0].Processor.Stats()
+	}
+
+	if nil != queue {
+		stats.QueueName = queue.Name()
+		stats.QueueTotalItem = queue.CountItems()
+	}
+
+	return stats
+}
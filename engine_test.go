@@ -0,0 +1,116 @@
+package redes_writer
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEngine(t *testing.T) {
+	_, err := NewEngine(Options{})
+	assert.EqualError(t, err, "missing config")
+
+	cnf := &Config{}
+	cnf.ElasticSearch.Url = "http://127.0.0.1:9200/?sniff=false"
+	cnf.Routes = []RouteConfig{{Cluster: "archive"}}
+	_, err = NewEngine(Options{Config: cnf})
+	assert.EqualError(t, err, `routes[0]: unknown cluster "archive"`)
+
+	cnf.ElasticSearch.Clusters = []ClusterConfig{{Name: "archive", Url: "http://127.0.0.1:9201/?sniff=false"}}
+	engine, err := NewEngine(Options{Config: cnf, Counters: NewCounters()})
+	assert.NoError(t, err)
+
+	// not started yet.
+	stats := engine.Stats()
+	assert.Equal(t, "", stats.QueueName)
+	assert.Empty(t, stats.Clusters)
+	assert.NoError(t, engine.Stop(context.Background()))
+}
+
+func TestNewEngine_DryRun(t *testing.T) {
+	cnf := &Config{}
+	cnf.ElasticSearch.Url = "http://127.0.0.1:9200/?sniff=false"
+	engine, err := NewEngine(Options{Config: cnf})
+	assert.NoError(t, err)
+	assert.True(t, engine.writesToClusters())
+
+	// requests are printed, clusters are never written.
+	cnf.Listener.DryRun = true
+	engine, err = NewEngine(Options{Config: cnf})
+	assert.NoError(t, err)
+	assert.False(t, engine.writesToClusters())
+	assert.Len(t, engine.sinks, 1)
+	assert.IsType(t, &stdoutSink{}, engine.sinks[0])
+}
+
+func TestEngine_Stages(t *testing.T) {
+	// schema validates documents before their values are redacted.
+	cnf := &Config{}
+	cnf.Redactions = []RedactionConfig{{Name: "age", Paths: []string{"$.age"}}}
+	cnf.Schemas = []SchemaConfig{{Index: "lr", Schema: map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"age": map[string]interface{}{"type": "integer", "minimum": 0}},
+	}}}
+
+	engine, err := NewEngine(Options{Config: cnf})
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	written := []*Request{}
+	writer := Chain(engine.stages...)(func(req *Request) error {
+		written = append(written, req)
+
+		return nil
+	})
+
+	req, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"age": 42}}}`)
+	assert.NoError(t, writer(req))
+
+	req, _ = fromBytes(`{"type": "index", "index": {"index": "lr", "id": "2", "doc": {"age": "old"}}}`)
+	assert.IsType(t, &ValidationError{}, writer(req))
+
+	assert.Len(t, written, 1)
+	assert.Equal(t, map[string]interface{}{"age": "***"}, written[0].Index.Doc)
+}
+
+func TestEngine(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := newRedisClient(redisUrl())
+	client.FlushAll()
+
+	// without Elastic Search, requests are only written to the sink.
+	cnf := &Config{}
+	cnf.Redis.QueueName = "engine"
+	out := &bytes.Buffer{}
+	engine, err := NewEngine(Options{Config: cnf, Redis: client, Sinks: []Sink{&stdoutSink{out: out}}})
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	if err := engine.Start(ctx); nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	queue, _ := NewQueue(client, "engine")
+	assert.NoError(t, queue.Write(`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`))
+
+	time.Sleep(time.Second)
+	assert.NoError(t, engine.Stop(ctx))
+	assert.True(t, strings.Contains(out.String(), `"_id":"1"`))
+	assert.Equal(t, int64(1), engine.Stats().Counters["sink.sink0.written"])
+
+	// stopped engine doesn't dequeue anymore.
+	assert.NoError(t, queue.Write(`{"type": "delete", "delete": {"index": "lr", "id": "2"}}`))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int64(1), queue.CountItems())
+}
@@ -0,0 +1,142 @@
+package redes_writer
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultErrorLogSize = 100
+
+type (
+	// ErrorRecord is a recent error, kept to diagnose es-writer without
+	// access to its logs. Raw messages are not kept, only the document they
+	// address: admin API is not authenticated.
+	ErrorRecord struct {
+		Time     time.Time `json:"time"`
+		Severity Severity  `json:"severity"`
+		Type     string    `json:"type"` // error type of failed item, e.g. mapper_parsing_exception, or kind of error
+		Message  string    `json:"message"`
+		Reason   string    `json:"reason,omitempty"`
+		Cluster  string    `json:"cluster,omitempty"`
+		Index    string    `json:"index,omitempty"`
+		Id       string    `json:"id,omitempty"`
+		Op       string    `json:"op,omitempty"`
+	}
+
+	// ErrorFilter selects recent errors, empty fields match all.
+	ErrorFilter struct {
+		Index    string
+		Type     string
+		Severity string
+		Limit    int
+	}
+
+	// errorLog is a ring buffer of the last reported errors.
+	errorLog struct {
+		mu      sync.Mutex
+		records []ErrorRecord
+		next    int
+		full    bool
+	}
+)
+
+func newErrorLog(size int) *errorLog {
+	if size <= 0 {
+		size = defaultErrorLogSize
+	}
+
+	return &errorLog{records: make([]ErrorRecord, size)}
+}
+
+func newErrorRecord(err Error) ErrorRecord {
+	record := ErrorRecord{Time: time.Now(), Severity: err.Severity(), Message: err.Error()}
+
+	switch e := err.(type) {
+	case *ItemError:
+		record.Type, record.Reason = e.Type, e.Reason
+		record.Cluster, record.Index, record.Id, record.Op = e.Cluster, e.Index, e.Id, e.Op
+
+	case *TaskError:
+		record.Type, record.Reason = "task_error", e.Reason
+		record.Cluster, record.Index, record.Id, record.Op = e.Cluster, e.Index, e.Id, e.Type
+
+	case *ParseError:
+		record.Type = "parse_error"
+
+	case *ValidationError:
+		record.Type = "validation_error"
+
+	case *QueueError:
+		record.Type = "queue_error"
+
+	case *RetryError:
+		record.Type = "retry"
+
+	case *ElasticError:
+		record.Type, record.Cluster = "elastic_error", e.Cluster
+
+	default:
+		record.Type = "error"
+	}
+
+	if raw := err.RawMessage(); "" != raw {
+		if req, parseErr := fromBytes(raw); nil == parseErr {
+			record.Index, record.Id, record.Op = req.indexName(), req.id(), req.Type
+		}
+	}
+
+	return record
+}
+
+func (l *errorLog) add(err Error) {
+	record := newErrorRecord(err)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.records[l.next] = record
+	l.next = (l.next + 1) % len(l.records)
+	if 0 == l.next {
+		l.full = true
+	}
+}
+
+// list returns matching errors, newest first.
+func (l *errorLog) list(filter ErrorFilter) []ErrorRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	count := l.next
+	if l.full {
+		count = len(l.records)
+	}
+
+	records := []ErrorRecord{}
+	for i := 1; i <= count; i++ {
+		record := l.records[(l.next-i+len(l.records))%len(l.records)]
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+
+		if filter.Limit > 0 && len(records) >= filter.Limit {
+			break
+		}
+	}
+
+	return records
+}
+
+func (f ErrorFilter) matches(record ErrorRecord) bool {
+	switch {
+	case "" != f.Index && f.Index != record.Index:
+		return false
+
+	case "" != f.Type && f.Type != record.Type:
+		return false
+
+	case "" != f.Severity && f.Severity != record.Severity.String():
+		return false
+	}
+
+	return true
+}
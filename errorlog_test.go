@@ -0,0 +1,64 @@
+package redes_writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorLog(t *testing.T) {
+	log := newErrorLog(3)
+	assert.Empty(t, log.list(ErrorFilter{}))
+
+	for i := 0; i < 4; i++ {
+		log.add(&ItemError{Cluster: "default", Index: "lr", Id: fmt.Sprint(i), Op: "index", Type: "mapper_parsing_exception"})
+	}
+
+	records := log.list(ErrorFilter{})
+	assert.Len(t, records, 3, "oldest error is dropped")
+	assert.Equal(t, "3", records[0].Id, "newest first")
+	assert.Equal(t, "1", records[2].Id)
+	assert.Len(t, log.list(ErrorFilter{Limit: 2}), 2)
+
+	log.add(&ValidationError{Raw: `{"type": "delete", "delete": {"index": "archive", "id": "9"}}`, Err: fmt.Errorf("denied")})
+	records = log.list(ErrorFilter{Index: "archive"})
+	assert.Len(t, records, 1)
+	assert.Equal(t, "validation_error", records[0].Type)
+	assert.Equal(t, "9", records[0].Id)
+	assert.Equal(t, "delete", records[0].Op)
+	assert.Equal(t, SeverityWarning, records[0].Severity)
+
+	// documents are never kept.
+	log.add(&ValidationError{Raw: `{"type": "index", "index": {"index": "users", "id": "1", "doc": {"email": "john@example.com"}}}`, Err: fmt.Errorf("denied")})
+	raw, _ := json.Marshal(log.list(ErrorFilter{Index: "users"}))
+	assert.Contains(t, string(raw), `"id":"1"`)
+	assert.NotContains(t, string(raw), "john@example.com")
+
+	assert.Len(t, log.list(ErrorFilter{Type: "mapper_parsing_exception"}), 1)
+	assert.Len(t, log.list(ErrorFilter{Severity: "warning"}), 2)
+	assert.Empty(t, log.list(ErrorFilter{Index: "lr", Type: "validation_error"}))
+}
+
+func TestAdminHandler_Errors(t *testing.T) {
+	engine, err := NewEngine(Options{Config: &Config{}})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	engine.errors.publish(&ParseError{Raw: "invalid", Err: fmt.Errorf("bad json")})
+	engine.errors.publish(&ItemError{Cluster: "default", Index: "lr", Id: "1", Op: "update", Type: "document_missing_exception"})
+
+	res := httptest.NewRecorder()
+	NewAdminHandler(engine).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/errors?index=lr", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	records := []ErrorRecord{}
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &records))
+	assert.Len(t, records, 1)
+	assert.Equal(t, "document_missing_exception", records[0].Type)
+	assert.Equal(t, SeverityError, records[0].Severity)
+}
@@ -0,0 +1,317 @@
+package redes_writer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Severity tells embedding applications how serious an error is.
+type Severity int
+
+const (
+	// request was not written, es-writer keeps working, e.g. invalid message.
+	SeverityWarning Severity = iota
+
+	// writing failed, requests may be lost.
+	SeverityError
+
+	// es-writer can not work, e.g. queue is still not reachable after retrying.
+	SeverityFatal
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+
+	case SeverityError:
+		return "error"
+	}
+
+	return "fatal"
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "warning":
+		*s = SeverityWarning
+
+	case "error":
+		*s = SeverityError
+
+	case "fatal":
+		*s = SeverityFatal
+
+	default:
+		return fmt.Errorf("unknown severity %q", text)
+	}
+
+	return nil
+}
+
+type (
+	// Error is reported by Engine, with the raw message which caused it.
+	Error interface {
+		error
+		Severity() Severity
+		RawMessage() string // empty when error is not caused by a message
+	}
+
+	// ParseError is reported for messages which are not valid requests.
+	ParseError struct {
+		Raw string
+		Err error
+	}
+
+	// ValidationError is reported for requests which can never be written,
+	// e.g. invalid documents. They are moved to the rejection queue.
+	ValidationError struct {
+		Raw string
+		Err error
+	}
+
+	// QueueError is reported when reading from or writing to Redis failed.
+	// Reading is retried, the error is fatal once es-writer gives up.
+	QueueError struct {
+		Raw   string
+		Err   error
+		Fatal bool
+	}
+
+	// ElasticError is reported when a request could not be handed to a
+	// cluster or a sink.
+	ElasticError struct {
+		Raw     string
+		Cluster string // empty when not specific to a cluster
+		Err     error
+	}
+
+	// RetryError is reported for requests which were not written but can be
+	// written later, e.g. while es-writer is stopping: they are put back to
+	// head of the queue.
+	RetryError struct {
+		Raw string
+		Err error
+	}
+
+	// ThrottleError is returned for requests exceeding rate limits: they are
+	// put aside until the time they're allowed, without holding other requests.
+	ThrottleError struct {
+		Until  time.Time
+		cancel func() // releases reserved tokens when request is not deferred
+	}
+
+	// TaskError is reported when a by-query task completed with failures.
+	TaskError struct {
+		Cluster  string
+		Id       string
+		Type     string // update_by_query or delete_by_query
+		Index    string
+		Failures int // documents which failed
+		Reason   string
+	}
+
+	// ItemError is reported when Elastic Search failed a request of a bulk.
+	ItemError struct {
+		Cluster string
+		Index   string
+		Id      string
+		Op      string // index, update or delete
+		Status  int
+		Type    string // e.g. mapper_parsing_exception
+		Reason  string
+	}
+)
+
+func (e *ParseError) Error() string {
+	return "invalid message: " + e.Err.Error()
+}
+
+func (e *ParseError) Severity() Severity {
+	return SeverityWarning
+}
+
+func (e *ParseError) RawMessage() string {
+	return e.Raw
+}
+
+func (e *ValidationError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ValidationError) Severity() Severity {
+	return SeverityWarning
+}
+
+func (e *ValidationError) RawMessage() string {
+	return e.Raw
+}
+
+func (e *QueueError) Error() string {
+	return "queue: " + e.Err.Error()
+}
+
+func (e *QueueError) Severity() Severity {
+	if e.Fatal {
+		return SeverityFatal
+	}
+
+	return SeverityError
+}
+
+func (e *QueueError) RawMessage() string {
+	return e.Raw
+}
+
+func (e *ElasticError) Error() string {
+	if "" != e.Cluster {
+		return fmt.Sprintf("cluster %s: %s", e.Cluster, e.Err)
+	}
+
+	return e.Err.Error()
+}
+
+func (e *ElasticError) Severity() Severity {
+	return SeverityError
+}
+
+func (e *ElasticError) RawMessage() string {
+	return e.Raw
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("cluster %s: failed to %s %s/%s: %s: %s", e.Cluster, e.Op, e.Index, e.Id, e.Type, e.Reason)
+}
+
+func (e *ItemError) Severity() Severity {
+	return SeverityError
+}
+
+func (e *ItemError) RawMessage() string {
+	return ""
+}
+
+func (e *RetryError) Error() string {
+	return "will retry: " + e.Err.Error()
+}
+
+func (e *RetryError) Severity() Severity {
+	return SeverityWarning
+}
+
+func (e *RetryError) RawMessage() string {
+	return e.Raw
+}
+
+func (e *ThrottleError) Error() string {
+	return "throttled until " + e.Until.Format(time.RFC3339Nano)
+}
+
+func (e *ThrottleError) Severity() Severity {
+	return SeverityWarning
+}
+
+func (e *ThrottleError) RawMessage() string {
+	return ""
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("cluster %s: task %s (%s of %s) failed: %s", e.Cluster, e.Id, e.Type, e.Index, e.Reason)
+}
+
+func (e *TaskError) Severity() Severity {
+	return SeverityError
+}
+
+func (e *TaskError) RawMessage() string {
+	return ""
+}
+
+// reject marks request which can never be written.
+func reject(reason error) error {
+	return &ValidationError{Err: reason}
+}
+
+// withRaw attaches raw message to the error, untyped errors are errors of writing.
+func withRaw(err error, raw string) Error {
+	switch e := err.(type) {
+	case *ParseError:
+		e.Raw = raw
+
+		return e
+
+	case *ValidationError:
+		e.Raw = raw
+
+		return e
+
+	case *QueueError:
+		e.Raw = raw
+
+		return e
+
+	case *RetryError:
+		e.Raw = raw
+
+		return e
+
+	case *ElasticError:
+		e.Raw = raw
+
+		return e
+
+	case Error:
+		return e
+	}
+
+	return &ElasticError{Raw: raw, Err: err}
+}
+
+// errorHub delivers errors to callbacks & a buffered channel, without ever
+// blocking the reporter: errors are dropped when the channel is full.
+type errorHub struct {
+	mu        sync.RWMutex
+	callbacks []func(err Error)
+	ch        chan error
+	counters  *Counters
+}
+
+func newErrorHub(size int, counters *Counters) *errorHub {
+	return &errorHub{ch: make(chan error, size), counters: counters}
+}
+
+func (h *errorHub) subscribe(callback func(err Error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.callbacks = append(h.callbacks, callback)
+}
+
+func (h *errorHub) publish(err error) {
+	e, ok := err.(Error)
+	if !ok {
+		// errors without a message come from the queue.
+		e = &QueueError{Err: err}
+	}
+
+	h.counters.Add("errors."+e.Severity().String(), 1)
+
+	h.mu.RLock()
+	callbacks := h.callbacks
+	h.mu.RUnlock()
+
+	for _, callback := range callbacks {
+		callback(e)
+	}
+
+	select {
+	case h.ch <- e:
+	default:
+		h.counters.Add("errors.dropped", 1)
+	}
+}
@@ -0,0 +1,176 @@
+package redes_writer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memoryQueue is a Queue without Redis.
+type memoryQueue struct {
+	ch       chan string
+	rejected []string
+	requeued []string
+	mu       sync.Mutex
+	deferred []deferredItem
+}
+
+type deferredItem struct {
+	payload string
+	until   time.Time
+}
+
+func (q *memoryQueue) Write(payload ...interface{}) error {
+	for _, item := range payload {
+		q.ch <- fmt.Sprint(item)
+	}
+
+	return nil
+}
+
+func (q *memoryQueue) Listen(ctx context.Context, errCh chan error) chan string { return q.ch }
+func (q *memoryQueue) Name() string                                             { return "memory" }
+func (q *memoryQueue) CountItems() int64                                        { return int64(len(q.ch)) }
+
+func (q *memoryQueue) Requeue(payload string) error {
+	q.requeued = append(q.requeued, payload)
+
+	return nil
+}
+
+func (q *memoryQueue) Defer(payload string, until time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.deferred = append(q.deferred, deferredItem{payload: payload, until: until})
+	sort.SliceStable(q.deferred, func(i, j int) bool { return q.deferred[i].until.Before(q.deferred[j].until) })
+
+	return nil
+}
+
+func (q *memoryQueue) Due(now time.Time) (string, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if 0 == len(q.deferred) || q.deferred[0].until.After(now) {
+		return "", false, nil
+	}
+
+	item := q.deferred[0]
+	q.deferred = q.deferred[1:]
+
+	return item.payload, true, nil
+}
+
+func (q *memoryQueue) Reject(payload string, reason string) error {
+	q.rejected = append(q.rejected, reason)
+
+	return nil
+}
+
+func TestListener_TypedErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queue := &memoryQueue{ch: make(chan string, 10)}
+	errCh := make(chan error, 10)
+	writer := func(req *Request) error {
+		switch req.Index.Id {
+		case "invalid":
+			return reject(fmt.Errorf("invalid document"))
+
+		case "full":
+			return &ElasticError{Cluster: "es7", Err: fmt.Errorf("buffer is full")}
+
+		case "closed":
+			return &RetryError{Err: &ElasticError{Cluster: "es7", Err: fmt.Errorf("cluster is closed")}}
+		}
+
+		return nil
+	}
+
+	assert.NoError(t, NewListener().Run(ctx, errCh, queue, writer))
+	_ = queue.Write(
+		`{"type": "index", "index": {"index": "lr", "id": "ok"}}`,
+		`not json`,
+		`{"type": "index", "index": {"index": "lr", "id": "invalid"}}`,
+		`{"type": "index", "index": {"index": "lr", "id": "full"}}`,
+		`{"type": "index", "index": {"index": "lr", "id": "closed"}}`,
+	)
+
+	errs := []Error{}
+	for len(errs) < 4 {
+		select {
+		case err := <-errCh:
+			errs = append(errs, err.(Error))
+
+		case <-time.After(time.Second):
+			t.Error("missing errors")
+			t.FailNow()
+		}
+	}
+
+	assert.IsType(t, &ParseError{}, errs[0])
+	assert.Equal(t, "not json", errs[0].RawMessage())
+	assert.Equal(t, SeverityWarning, errs[0].Severity())
+
+	assert.IsType(t, &ValidationError{}, errs[1])
+	assert.Equal(t, `{"type": "index", "index": {"index": "lr", "id": "invalid"}}`, errs[1].RawMessage())
+
+	assert.IsType(t, &ElasticError{}, errs[2])
+	assert.Equal(t, SeverityError, errs[2].Severity())
+	assert.Equal(t, "cluster es7: buffer is full", errs[2].Error())
+
+	assert.IsType(t, &RetryError{}, errs[3])
+	assert.Equal(t, "will retry: cluster es7: cluster is closed", errs[3].Error())
+
+	assert.Len(t, queue.rejected, 2)
+	assert.Equal(t, "invalid document", queue.rejected[1])
+	assert.Equal(t, []string{`{"type": "index", "index": {"index": "lr", "id": "closed"}}`}, queue.requeued)
+}
+
+func TestListener_Done(t *testing.T) {
+	queue := &memoryQueue{ch: make(chan string, 1)}
+	l := &listener{done: make(chan struct{})}
+	assert.NoError(t, l.Run(context.Background(), make(chan error, 1), queue, func(req *Request) error { return nil }))
+
+	close(queue.ch)
+	select {
+	case <-l.done:
+	case <-time.After(time.Second):
+		t.Error("listener is not done when the queue is closed")
+	}
+}
+
+func TestErrorHub(t *testing.T) {
+	counters := NewCounters()
+	hub := newErrorHub(1, counters)
+
+	received := []Error{}
+	hub.subscribe(func(err Error) {
+		received = append(received, err)
+	})
+
+	hub.publish(&ParseError{Raw: "x", Err: fmt.Errorf("bad")})
+	hub.publish(fmt.Errorf("connection refused"))
+
+	// channel is full, publishing doesn't block.
+	assert.Len(t, hub.ch, 1)
+	assert.Len(t, received, 2)
+	assert.IsType(t, &QueueError{}, received[1])
+	assert.Equal(t, SeverityError, received[1].Severity(), "redis is retried")
+	assert.Equal(t, SeverityFatal, (&QueueError{Err: fmt.Errorf("connection refused"), Fatal: true}).Severity())
+
+	assert.Equal(t, int64(1), counters.Get("errors.warning"))
+	assert.Equal(t, int64(1), counters.Get("errors.error"))
+	assert.Equal(t, int64(1), counters.Get("errors.dropped"))
+
+	raw, _ := json.Marshal(map[string]Severity{"severity": SeverityError})
+	assert.Equal(t, `{"severity":"error"}`, string(raw))
+}
@@ -0,0 +1,183 @@
+package redes_writer
+
+import (
+	"encoding/json"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+)
+
+const (
+	EventRequest = "request"
+	EventFlush   = "flush"
+	EventFailure = "failure"
+
+	eventBufferSize = 256
+)
+
+type (
+	// Event tells what es-writer is doing, for watching it in real time.
+	Event struct {
+		Time    time.Time       `json:"time"`
+		Kind    string          `json:"kind"` // request, flush or failure
+		Index   string          `json:"index,omitempty"`
+		Op      string          `json:"op,omitempty"`
+		Id      string          `json:"id,omitempty"`
+		Request json.RawMessage `json:"request,omitempty"` // dequeued request, after redaction
+		Flush   *FlushSummary   `json:"flush,omitempty"`
+		Error   *ErrorRecord    `json:"error,omitempty"` // failed item
+	}
+
+	// FlushSummary is the result of a bulk executed by a cluster.
+	FlushSummary struct {
+		Cluster     string `json:"cluster"`
+		ExecutionId int64  `json:"executionId"`
+		Requests    int    `json:"requests"`
+		Succeeded   int    `json:"succeeded"`
+		Failed      int    `json:"failed"`
+		Took        int    `json:"took"` // milliseconds, as reported by Elastic Search
+		Error       string `json:"error,omitempty"`
+	}
+
+	// EventFilter selects events, empty fields match all. Flush events are
+	// not specific to an index, they are only filtered by kind.
+	EventFilter struct {
+		Kinds  []string
+		Index  string // pattern, e.g. logs-*
+		Ops    []string
+		Sample float64 // fraction of request & failure events which are kept, 0 keeps all
+	}
+
+	// eventBus delivers events to subscribers without ever blocking
+	// publishers: events are dropped for subscribers which fall behind.
+	eventBus struct {
+		mu          sync.RWMutex
+		subscribers map[*eventSubscriber]bool
+		counters    *Counters
+	}
+
+	eventSubscriber struct {
+		ch     chan Event
+		filter EventFilter
+	}
+)
+
+func newEventBus(counters *Counters) *eventBus {
+	return &eventBus{subscribers: map[*eventSubscriber]bool{}, counters: counters}
+}
+
+func newFlushSummary(cluster string, executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) FlushSummary {
+	summary := FlushSummary{Cluster: cluster, ExecutionId: executionId, Requests: len(requests)}
+	if nil != response {
+		summary.Took = response.Took
+		summary.Succeeded = len(response.Succeeded())
+		summary.Failed = len(response.Failed())
+	}
+
+	if nil != err {
+		summary.Error = err.Error()
+	}
+
+	return summary
+}
+
+// subscribe returns channel of matching events, cancel must be called when
+// events are no longer consumed.
+func (b *eventBus) subscribe(filter EventFilter) (<-chan Event, func()) {
+	sub := &eventSubscriber{ch: make(chan Event, eventBufferSize), filter: filter}
+
+	b.mu.Lock()
+	b.subscribers[sub] = true
+	b.mu.Unlock()
+
+	var once sync.Once
+
+	return sub.ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, sub)
+			b.mu.Unlock()
+
+			close(sub.ch)
+		})
+	}
+}
+
+// publish sends event to matching subscribers, req is only encoded once when
+// some subscriber wants the event. Event is sent without request which can't
+// be encoded.
+func (b *eventBus) publish(event Event, req *Request) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	encoded := false
+	for sub := range b.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+
+		if nil != req && nil == event.Request && !encoded {
+			encoded = true
+			if raw, err := json.Marshal(req); nil == err {
+				event.Request = raw
+			}
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+			b.counters.Add("events.dropped", 1)
+		}
+	}
+}
+
+func (b *eventBus) active() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.subscribers) > 0
+}
+
+// wrap publishes requests going through the stages.
+func (b *eventBus) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req && b.active() {
+			b.publish(Event{Time: time.Now(), Kind: EventRequest, Index: req.indexName(), Op: req.Type, Id: req.id()}, req)
+		}
+
+		return writer(req)
+	}
+}
+
+func (b *eventBus) flushed(summary FlushSummary) {
+	if b.active() {
+		b.publish(Event{Time: time.Now(), Kind: EventFlush, Flush: &summary}, nil)
+	}
+}
+
+// failed publishes items failed by Elastic Search, other errors are only
+// kept as recent errors.
+func (b *eventBus) failed(err Error) {
+	if _, ok := err.(*ItemError); ok && b.active() {
+		record := newErrorRecord(err)
+		b.publish(Event{Time: record.Time, Kind: EventFailure, Index: record.Index, Op: record.Op, Id: record.Id, Error: &record}, nil)
+	}
+}
+
+func (f EventFilter) matches(event Event) bool {
+	if len(f.Kinds) > 0 && !contains(f.Kinds, event.Kind) {
+		return false
+	}
+
+	if EventFlush == event.Kind {
+		return true
+	}
+
+	if !matchIndex(f.Index, event.Index) || (len(f.Ops) > 0 && !contains(f.Ops, event.Op)) {
+		return false
+	}
+
+	return f.Sample <= 0 || f.Sample >= 1 || rand.Float64() < f.Sample
+}
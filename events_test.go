@@ -0,0 +1,162 @@
+package redes_writer
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	counters := NewCounters()
+	bus := newEventBus(counters)
+	writer := bus.wrap(func(req *Request) error { return nil })
+
+	// nothing is published without subscribers.
+	assert.NoError(t, writer(&Request{Type: "delete", Delete: Delete{Index: "lr", Id: "1"}}))
+
+	events, cancel := bus.subscribe(EventFilter{Index: "lr*", Ops: []string{"index", "delete"}})
+	assert.NoError(t, writer(&Request{Type: "update", Update: Update{Index: "lr", Id: "1"}}))
+	assert.NoError(t, writer(&Request{Type: "delete", Delete: Delete{Index: "archive", Id: "1"}}))
+	assert.NoError(t, writer(&Request{Type: "index", Index: Index{Index: "lr-2020", Id: "2", Doc: map[string]interface{}{"a": 1}}}))
+	bus.flushed(FlushSummary{Cluster: "default", Requests: 1})
+	bus.failed(&ItemError{Index: "lr", Id: "3", Op: "delete", Type: "version_conflict_engine_exception"})
+	bus.failed(&ParseError{Err: assert.AnError})
+
+	event := <-events
+	assert.Equal(t, EventRequest, event.Kind)
+	assert.Equal(t, "2", event.Id)
+	assert.Contains(t, string(event.Request), `"a":1`)
+
+	event = <-events
+	assert.Equal(t, EventFlush, event.Kind, "flush events are not filtered by index")
+	assert.Equal(t, 1, event.Flush.Requests)
+
+	event = <-events
+	assert.Equal(t, EventFailure, event.Kind)
+	assert.Equal(t, "version_conflict_engine_exception", event.Error.Type)
+	assert.Len(t, events, 0)
+
+	// slow subscribers miss events.
+	for i := 0; i < eventBufferSize+1; i++ {
+		bus.flushed(FlushSummary{})
+	}
+
+	assert.Equal(t, int64(1), counters.Snapshot()["events.dropped"])
+
+	cancel()
+	cancel()
+	assert.False(t, bus.active())
+}
+
+func TestEventBus_Unencodable(t *testing.T) {
+	bus := newEventBus(NewCounters())
+	first, cancelFirst := bus.subscribe(EventFilter{})
+	second, cancelSecond := bus.subscribe(EventFilter{})
+	defer cancelFirst()
+	defer cancelSecond()
+
+	// every subscriber receives the event, without the request.
+	doc := map[string]interface{}{"a": make(chan int)}
+	assert.NoError(t, bus.wrap(func(req *Request) error { return nil })(&Request{Type: "index", Index: Index{Index: "lr", Id: "1", Doc: doc}}))
+	for _, events := range []<-chan Event{first, second} {
+		assert.Len(t, events, 1)
+		event := <-events
+		assert.Equal(t, "1", event.Id)
+		assert.Nil(t, event.Request)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	request := Event{Kind: EventRequest, Index: "lr", Op: "index"}
+	assert.True(t, EventFilter{}.matches(request))
+	assert.False(t, EventFilter{Kinds: []string{EventFlush}}.matches(request))
+	assert.False(t, EventFilter{Index: "archive"}.matches(request))
+	assert.False(t, EventFilter{Ops: []string{"delete"}}.matches(request))
+	assert.True(t, EventFilter{Sample: 1}.matches(request))
+
+	kept := 0
+	for i := 0; i < 1000; i++ {
+		if (EventFilter{Sample: 0.1}).matches(request) {
+			kept++
+		}
+	}
+
+	assert.InDelta(t, 100, kept, 50)
+	assert.True(t, EventFilter{Sample: 0.000001}.matches(Event{Kind: EventFlush}), "flush events are not sampled")
+}
+
+func TestNewFlushSummary(t *testing.T) {
+	response := &elastic.BulkResponse{Took: 3, Items: []map[string]*elastic.BulkResponseItem{
+		{"index": {Status: 201}},
+		{"delete": {Status: 404, Error: &elastic.ErrorDetails{Type: "not_found"}}},
+	}}
+
+	summary := newFlushSummary("default", 7, make([]elastic.BulkableRequest, 2), response, nil)
+	assert.Equal(t, FlushSummary{Cluster: "default", ExecutionId: 7, Requests: 2, Succeeded: 1, Failed: 1, Took: 3}, summary)
+}
+
+func TestAdminHandler_EventsAuthorized(t *testing.T) {
+	cnf := &Config{}
+	cnf.Admin.Token = "secret"
+	engine, err := NewEngine(Options{Config: cnf})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	// documents are streamed, events require the token.
+	res := httptest.NewRecorder()
+	NewAdminHandler(engine).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+
+	engine, _ = NewEngine(Options{Config: &Config{}})
+	res = httptest.NewRecorder()
+	NewAdminHandler(engine).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.Equal(t, http.StatusForbidden, res.Code, "only served to localhost without token")
+	assert.False(t, engine.events.active())
+}
+
+func TestAdminHandler_Events(t *testing.T) {
+	engine, err := NewEngine(Options{Config: &Config{}})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(NewAdminHandler(engine))
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/events?kind=flush")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	// subscribed before headers are sent.
+	engine.events.flushed(FlushSummary{Cluster: "default", Requests: 5})
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(res.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	select {
+	case line := <-lines:
+		assert.Equal(t, "event: flush", line)
+		line = <-lines
+		assert.True(t, strings.HasPrefix(line, "data: {"))
+		assert.Contains(t, line, `"requests":5`)
+
+	case <-time.After(time.Second):
+		t.Error("event is not streamed")
+	}
+}
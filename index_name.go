@@ -0,0 +1,356 @@
+package redes_writer
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// parsed templates of index names are cached up to this many, index names
+// come with requests.
+const maxIndexTemplates = 100
+
+// indexNameResolver resolves dynamic index names of requests before they are
+// converted into bulk requests. Two forms are supported:
+//
+//   - Go template, with the request's document as .doc:
+//     audit-{{ .doc.created_at | date "2006.01.02" }}
+//   - Elastic Search date math:
+//     <audit-{now/d}>, <audit-{now/M{yyyy.MM}}>, <audit-{now-1d/d{yyyy.MM.dd|+07:00}}>
+type indexNameResolver struct {
+	location  *time.Location
+	now       func() time.Time
+	mu        sync.Mutex
+	templates map[string]*template.Template
+}
+
+func newIndexNameResolver(timeZone string) (*indexNameResolver, error) {
+	location, err := parseTimeZone(timeZone)
+	if nil != err {
+		return nil, err
+	}
+
+	return &indexNameResolver{
+		location:  location,
+		now:       time.Now,
+		templates: map[string]*template.Template{},
+	}, nil
+}
+
+// wrap returns a writer which resolves index names before writing.
+func (r *indexNameResolver) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req {
+			if err := r.resolve(req); nil != err {
+				return reject(err)
+			}
+		}
+
+		return writer(req)
+	}
+}
+
+func (r *indexNameResolver) resolve(req *Request) error {
+	name, err := r.resolveName(req.indexName(), req.doc())
+	if nil != err {
+		return err
+	}
+
+	req.setIndexName(name)
+
+	return nil
+}
+
+func (r *indexNameResolver) resolveName(name string, doc interface{}) (string, error) {
+	switch {
+	case strings.Contains(name, "{{"):
+		return r.execute(name, doc)
+
+	case strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">"):
+		return r.dateMath(name[1 : len(name)-1])
+	}
+
+	return name, nil
+}
+
+func (r *indexNameResolver) execute(name string, doc interface{}) (string, error) {
+	r.mu.Lock()
+	tpl, ok := r.templates[name]
+	if !ok {
+		var err error
+		tpl, err = template.
+			New(name).
+			Option("missingkey=error").
+			Funcs(template.FuncMap{"date": r.date, "now": r.localNow}).
+			Parse(name)
+
+		if nil != err {
+			r.mu.Unlock()
+			return "", err
+		}
+
+		if len(r.templates) < maxIndexTemplates {
+			r.templates[name] = tpl
+		}
+	}
+	r.mu.Unlock()
+
+	buf := &bytes.Buffer{}
+	err := tpl.Execute(buf, map[string]interface{}{"doc": doc})
+	if nil != err {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+func (r *indexNameResolver) localNow() time.Time {
+	return r.now().In(r.location)
+}
+
+// date formats value with Go layout, in configured time zone.
+// value can be RFC3339 string, epoch milliseconds or time.
+func (r *indexNameResolver) date(layout string, value interface{}) (string, error) {
+	var t time.Time
+
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+
+	case float64:
+		t = time.Unix(0, int64(v)*int64(time.Millisecond))
+
+	case int64:
+		t = time.Unix(0, v*int64(time.Millisecond))
+
+	case string:
+		var err error
+		t, err = time.Parse(time.RFC3339Nano, v)
+		if nil != err {
+			t, err = time.ParseInLocation("2006-01-02", v, r.location)
+			if nil != err {
+				return "", fmt.Errorf("can not parse date %q", v)
+			}
+		}
+
+	default:
+		return "", fmt.Errorf("can not format %v as date", value)
+	}
+
+	return t.In(r.location).Format(layout), nil
+}
+
+// dateMath resolves content of date math index name, between < and >.
+func (r *indexNameResolver) dateMath(expr string) (string, error) {
+	out := strings.Builder{}
+
+	for len(expr) > 0 {
+		start := strings.Index(expr, "{")
+		if start < 0 {
+			out.WriteString(expr)
+			break
+		}
+
+		out.WriteString(expr[:start])
+		end := matchingBrace(expr, start)
+		if end < 0 {
+			return "", fmt.Errorf("invalid date math expression %q", expr)
+		}
+
+		resolved, err := r.dateMathBlock(expr[start+1 : end])
+		if nil != err {
+			return "", err
+		}
+
+		out.WriteString(resolved)
+		expr = expr[end+1:]
+	}
+
+	return out.String(), nil
+}
+
+// dateMathBlock resolves one {now-1d/d{yyyy.MM.dd|+07:00}} block, without outer braces.
+func (r *indexNameResolver) dateMathBlock(block string) (string, error) {
+	math, format, location := block, "yyyy.MM.dd", r.location
+
+	if start := strings.Index(block, "{"); start >= 0 {
+		if !strings.HasSuffix(block, "}") {
+			return "", fmt.Errorf("invalid date math format %q", block)
+		}
+
+		math = block[:start]
+		format = block[start+1 : len(block)-1]
+		if pos := strings.Index(format, "|"); pos >= 0 {
+			var err error
+			location, err = parseTimeZone(format[pos+1:])
+			if nil != err {
+				return "", err
+			}
+
+			format = format[:pos]
+		}
+	}
+
+	if !strings.HasPrefix(math, "now") {
+		return "", fmt.Errorf("date math must start with now: %q", math)
+	}
+
+	t, err := applyDateMath(r.now().In(location), math[len("now"):])
+	if nil != err {
+		return "", err
+	}
+
+	return t.Format(jodaToLayout(format)), nil
+}
+
+func matchingBrace(s string, start int) int {
+	depth := 0
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			depth++
+
+		case '}':
+			depth--
+			if 0 == depth {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// applyDateMath applies operations like +1d, -2h, /M to t.
+func applyDateMath(t time.Time, ops string) (time.Time, error) {
+	for len(ops) > 0 {
+		op := ops[0]
+		ops = ops[1:]
+
+		switch op {
+		case '/':
+			if 0 == len(ops) {
+				return t, fmt.Errorf("missing rounding unit")
+			}
+
+			t = roundDown(t, ops[0])
+			ops = ops[1:]
+
+		case '+', '-':
+			i := 0
+			for i < len(ops) && ops[i] >= '0' && ops[i] <= '9' {
+				i++
+			}
+
+			if i == len(ops) {
+				return t, fmt.Errorf("missing date math unit")
+			}
+
+			n := 1
+			if i > 0 {
+				n, _ = strconv.Atoi(ops[:i])
+			}
+
+			if '-' == op {
+				n = -n
+			}
+
+			var err error
+			t, err = addUnit(t, n, ops[i])
+			if nil != err {
+				return t, err
+			}
+
+			ops = ops[i+1:]
+
+		default:
+			return t, fmt.Errorf("invalid date math operator %q", op)
+		}
+	}
+
+	return t, nil
+}
+
+func addUnit(t time.Time, n int, unit byte) (time.Time, error) {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0), nil
+	case 'M':
+		return t.AddDate(0, n, 0), nil
+	case 'w':
+		return t.AddDate(0, 0, 7*n), nil
+	case 'd':
+		return t.AddDate(0, 0, n), nil
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour), nil
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute), nil
+	case 's':
+		return t.Add(time.Duration(n) * time.Second), nil
+	}
+
+	return t, fmt.Errorf("invalid date math unit %q", unit)
+}
+
+func roundDown(t time.Time, unit byte) time.Time {
+	y, m, d := t.Date()
+	loc := t.Location()
+
+	switch unit {
+	case 'y':
+		return time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+	case 'M':
+		return time.Date(y, m, 1, 0, 0, 0, 0, loc)
+	case 'w': // weeks start on Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		return time.Date(y, m, d-offset, 0, 0, 0, 0, loc)
+	case 'd':
+		return time.Date(y, m, d, 0, 0, 0, 0, loc)
+	case 'h', 'H':
+		return time.Date(y, m, d, t.Hour(), 0, 0, 0, loc)
+	case 'm':
+		return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, loc)
+	case 's':
+		return time.Date(y, m, d, t.Hour(), t.Minute(), t.Second(), 0, loc)
+	}
+
+	return t
+}
+
+// jodaToLayout converts date format used by Elastic Search into Go layout.
+func jodaToLayout(format string) string {
+	return strings.NewReplacer(
+		"yyyy", "2006",
+		"YYYY", "2006",
+		"yy", "06",
+		"MM", "01",
+		"dd", "02",
+		"HH", "15",
+		"mm", "04",
+		"ss", "05",
+	).Replace(format)
+}
+
+// parseTimeZone accepts location name (Asia/Ho_Chi_Minh) or offset (+07:00).
+func parseTimeZone(name string) (*time.Location, error) {
+	if "" == name {
+		return time.UTC, nil
+	}
+
+	if '+' == name[0] || '-' == name[0] {
+		t, err := time.Parse("-07:00", name)
+		if nil != err {
+			return nil, fmt.Errorf("invalid time zone %q", name)
+		}
+
+		_, offset := t.Zone()
+
+		return time.FixedZone(name, offset), nil
+	}
+
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,80 @@
+package redes_writer
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexNameResolver(t *testing.T) {
+	r, err := newIndexNameResolver("+07:00")
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// 2026-10-18 20:30 UTC is 2026-10-19 03:30 at +07:00
+	r.now = func() time.Time { return time.Date(2026, 10, 18, 20, 30, 0, 0, time.UTC) }
+
+	cases := map[string]string{
+		"audit":                                           "audit",
+		"<audit-{now/d}>":                                 "audit-2026.10.19",
+		"<audit-{now/M{yyyy.MM}}>":                        "audit-2026.10",
+		"<audit-{now-1d/d}>":                              "audit-2026.10.18",
+		"<audit-{now/d{yyyy.MM.dd|+00:00}}>":              "audit-2026.10.18",
+		"<audit-{now/w{yyyy.MM.dd}}-archive>":             "audit-2026.10.19-archive",
+		`audit-{{ now.Format "2006.01.02" }}`:             "audit-2026.10.19",
+		`audit-{{ .doc.created_at | date "2006.01.02" }}`: "audit-2026.10.19",
+	}
+
+	doc := map[string]interface{}{"created_at": "2026-10-18T18:00:00Z"}
+	for name, expected := range cases {
+		actual, err := r.resolveName(name, doc)
+		assert.NoError(t, err, name)
+		assert.Equal(t, expected, actual, name)
+	}
+
+	// epoch milliseconds, as decoded from JSON
+	actual, _ := r.resolveName(`audit-{{ .doc.created_at | date "2006.01" }}`, map[string]interface{}{"created_at": float64(1760000000000)})
+	assert.Equal(t, "audit-2025.10", actual)
+
+	_, err = r.resolveName(`audit-{{ .doc.created_at | date "2006.01.02" }}`, map[string]interface{}{})
+	assert.Error(t, err)
+
+	_, err = r.resolveName("<audit-{yesterday}>", nil)
+	assert.Error(t, err)
+}
+
+func TestIndexNameResolver_Request(t *testing.T) {
+	r, _ := newIndexNameResolver("UTC")
+	req, _ := fromBytes(`{"type": "update", "update": {"index": "audit-{{ .doc.created_at | date \"2006.01.02\" }}", "id": "123", "doc": {"created_at": "2026-10-18T23:00:00-02:00"}}}`)
+
+	assert.NoError(t, r.resolve(req))
+	assert.Equal(t, "audit-2026.10.19", req.Update.Index)
+}
+
+func TestIndexNameResolver_Wrap(t *testing.T) {
+	r, _ := newIndexNameResolver("UTC")
+	writer := r.wrap(func(req *Request) error { return nil })
+
+	// message can't be written anywhere, it's moved to the rejection queue.
+	for _, raw := range []string{
+		`{"type": "index", "index": {"index": "audit-{{ .doc.created_at | date \"2006.01.02\" }}", "id": "1", "doc": {}}}`,
+		`{"type": "delete", "delete": {"index": "audit-{{ .doc.created_at }}", "id": "1"}}`,
+		`{"type": "delete", "delete": {"index": "<audit-{yesterday}>", "id": "1"}}`,
+	} {
+		req, _ := fromBytes(raw)
+		assert.IsType(t, &ValidationError{}, writer(req), raw)
+	}
+
+	// templates of requests don't grow the cache forever.
+	for i := 0; i < 2*maxIndexTemplates; i++ {
+		req, _ := fromBytes(fmt.Sprintf(`{"type": "index", "index": {"index": "audit-{{ \"%d\" }}", "id": "1", "doc": {}}}`, i))
+		assert.NoError(t, writer(req))
+		assert.Equal(t, fmt.Sprintf("audit-%d", i), req.Index.Index)
+	}
+
+	assert.Len(t, r.templates, maxIndexTemplates)
+}
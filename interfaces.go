@@ -2,6 +2,8 @@ package redes_writer
 
 import (
 	"context"
+	"fmt"
+	"time"
 	"github.com/go-redis/redis"
 	"github.com/olivere/elastic/v7"
 	"github.com/sirupsen/logrus"
@@ -21,6 +23,20 @@ type (
 		Name() string
 
 		CountItems() int64
+
+		// move request which can never be written to the rejection queue,
+		// so that it can be inspected later.
+		Reject(payload string, reason string) error
+
+		// put request back to head of the queue, e.g. request which was not
+		// written because es-writer is stopping.
+		Requeue(payload string) error
+
+		// put throttled request aside until it's due, see Due.
+		Defer(payload string, until time.Time) error
+
+		// take one deferred request which is due, in the order they're due.
+		Due(now time.Time) (payload string, ok bool, err error)
 	}
 
 	Listener interface {
@@ -29,45 +45,130 @@ type (
 		Run(ctx context.Context, errCh chan error, q Queue, writer Writer) error
 	}
 
+	// alternative destination of requests, e.g. file or HTTP webhook.
+	Sink interface {
+		Write(req *Request) error
+		Close() error
+	}
+
 	// from  bulk-able request, send to ElasticServer
 	// make this an interface, so that we can mock for unit testing without
 	// real elastic-search server.
 	Writer func(req *Request) error
+
+	// cross-cutting behavior around Writer, e.g. logging, see Chain.
+	Middleware func(writer Writer) Writer
 )
 
 func NewQueue(client *redis.Client, name string) (Queue, error) {
 	return newQueue(client, name)
 }
 
+func NewSink(cnf SinkConfig) (Sink, error) {
+	return newSink(cnf)
+}
+
 func NewListener() Listener {
 	return newListener()
 }
 
 func NewProcessor(ctx context.Context, client *elastic.Client, cnf *Config) (*elastic.BulkProcessor, error) {
+	return newProcessor(ctx, client, cnf, defaultCluster, DefaultCounters(), nil, processorHooks{})
+}
+
+// processorHooks are informed about executed bulks, all are optional and
+// must not block.
+type processorHooks struct {
+	report  func(err error)            // failed bulks & items
+	flushed func(summary FlushSummary) // all executed bulks
+	failed  func(req Request)          // requests which were not applied
+}
+
+// bp is optional, it's informed about executed bulks.
+func newProcessor(ctx context.Context, client *elastic.Client, cnf *Config, cluster string, counters *Counters, bp *backpressure, hooks processorHooks) (*elastic.BulkProcessor, error) {
 	// should read: https://github.com/olivere/elastic/wiki/BulkProcessor
 
-	return client.BulkProcessor().
-		Name("es-writer").
-		BulkSize(cnf.Listener.BufferSize).
+	service := client.BulkProcessor().
+		Name("es-writer-" + cluster).
 		FlushInterval(cnf.Listener.FlushInterval).
-		Stats(true).
-		// Workers(5)                TODO: Learn this feature
+		Stats(true)
+
+	if cnf.Listener.BulkActions > 0 {
+		service.BulkActions(cnf.Listener.BulkActions)
+	}
+
+	if cnf.Listener.BulkSize > 0 {
+		service.BulkSize(cnf.Listener.BulkSize)
+	}
+
+	if cnf.Listener.Workers > 0 {
+		service.Workers(cnf.Listener.Workers)
+	}
+
+	return service.
 		// RetryItemStatusCodes(400) // default: 408, 429, 503, 507
+		Before(
+			func(executionId int64, requests []elastic.BulkableRequest) {
+				if nil != bp {
+					bp.before(executionId, requests)
+				}
+			},
+		).
 		After(
 			func(executionId int64, requests []elastic.BulkableRequest, response *elastic.BulkResponse, err error) {
+				if nil != bp {
+					bp.after(executionId, requests, response, err)
+				}
+
 				if err != nil {
-					logrus.WithError(err).Errorln("process error")
+					counters.Add("cluster."+cluster+".errors", 1)
+					logrus.WithError(err).WithField("cluster", cluster).Errorln("process error")
+
+					if nil != hooks.report {
+						hooks.report(&ElasticError{Cluster: cluster, Err: err})
+					}
+				}
+
+				if nil != hooks.failed {
+					for _, req := range failedRequests(requests, response, err) {
+						hooks.failed(req)
+					}
+				}
+
+				if nil != hooks.flushed {
+					hooks.flushed(newFlushSummary(cluster, executionId, requests, response, err))
+				}
+
+				if nil == response {
+					return
 				}
 
 				for _, rItem := range response.Items {
 					for riKey, riValue := range rItem {
-						if riValue.Error != nil {
+						if nil == riValue.Error {
+							counters.Add("index."+riValue.Index+".written", 1)
+						} else {
+							counters.Add("cluster."+cluster+".failed", 1)
+							counters.Add("index."+riValue.Index+".failed", 1)
 							logrus.
+								WithField("cluster", cluster).
 								WithField("key", riKey).
 								WithField("type", riValue.Error.Type).
 								WithField("phase", riValue.Error.Phase).
 								WithField("reason", riValue.Error.Reason).
 								Errorf("failed to process item %s", riKey)
+
+							if nil != hooks.report {
+								hooks.report(&ItemError{
+									Cluster: cluster,
+									Index:   riValue.Index,
+									Id:      riValue.Id,
+									Op:      riKey,
+									Status:  riValue.Status,
+									Type:    riValue.Error.Type,
+									Reason:  riValue.Error.Reason,
+								})
+							}
 						}
 					}
 				}
@@ -76,10 +177,24 @@ func NewProcessor(ctx context.Context, client *elastic.Client, cnf *Config) (*el
 		Do(ctx)
 }
 
+// NewWriter returns a writer to clusters, or to a single bulk processor for
+// requests which are bulk-able, given as "clusters" or "processor" value of ctx.
+// Engine writes to all configured clusters instead.
 func NewWriter(ctx context.Context) (Writer, error) {
-	processor := ctx.Value("processor").(*elastic.BulkProcessor)
+	if clusters, ok := ctx.Value("clusters").(Clusters); ok {
+		return clusters.write, nil
+	}
+
+	processor, ok := ctx.Value("processor").(*elastic.BulkProcessor)
+	if !ok {
+		return nil, fmt.Errorf("missing processor in context")
+	}
 
 	return func(req *Request) error {
+		if nil != req && (req.isAdmin() || req.isByQuery()) {
+			return fmt.Errorf("%s request is not bulk-able", req.Type)
+		}
+
 		if nil != req {
 			processor.Add(*req)
 		}
@@ -88,43 +203,38 @@ func NewWriter(ctx context.Context) (Writer, error) {
 	}, nil
 }
 
-
-func Run(ctx context.Context, cnfPath string) (*elastic.BulkProcessor, Queue, chan error, error) {
+// Run starts an Engine configured by file in cnfPath. Reported errors are sent
+// to the returned channel, they're dropped when it's not consumed fast enough.
+// Build the engine with NewEngine to stop it, or to inspect it.
+func Run(ctx context.Context, cnfPath string) (Clusters, Queue, chan error, error) {
 	cnf, err := NewConfig(cnfPath)
 	if nil != err {
 		return nil, nil, nil, err
 	}
 
-	cElasticSearch, err := newElasticSearchClient(cnf.ElasticSearch.Url)
-	if nil != err {
-		return nil, nil, nil, err
-	}
-
-	cRedis := newRedisClient(cnf.Redis.Url)
-	queue, err := NewQueue(cRedis, cnf.Redis.QueueName)
+	engine, err := NewEngine(Options{Config: cnf})
 	if nil != err {
 		return nil, nil, nil, err
 	}
 
-	processor, err := NewProcessor(ctx, cElasticSearch, cnf)
-	if nil != err {
-		return nil, nil, nil, err
-	}
+	errCh := make(chan error, 64)
+	engine.OnError(func(err Error) {
+		select {
+		case errCh <- err:
+		default:
+		}
+	})
 
-	ctx = context.WithValue(ctx, "processor", processor)
-	writer, err := NewWriter(ctx)
-	if nil != err {
+	if err := engine.Start(ctx); nil != err {
 		return nil, nil, nil, err
 	}
 
-	errCh, err := run(ctx, queue, writer)
-
-	return processor, queue, errCh, err
+	return engine.Clusters(), engine.queue, errCh, nil
 }
 
-func run(ctx context.Context, queue Queue, writer Writer) (chan error, error) {
+func run(ctx context.Context, queue Queue, listener Listener, writer Writer) (chan error, error) {
 	errCh := make(chan error, 1)
-	err := NewListener().Run(ctx, errCh, queue, writer)
+	err := listener.Run(ctx, errCh, queue, writer)
 	if nil != err {
 		return nil, err
 	}
@@ -3,12 +3,14 @@ package redes_writer
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
 	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/olivere/elastic/v7"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -297,7 +299,7 @@ func TestEndToEnd(t *testing.T) {
 	client := newRedisClient(redisUrl())
 	client.FlushAll()
 	queue, _ := NewQueue(client, "myQueue")
-	_, _ = run(ctx, queue, writer)
+	_, _ = run(ctx, queue, NewListener(), writer)
 
 	// send some requests into queue
 	m1 := `{"type": "index","index": {"index": "lr","type":  "enrolment","id":    "123","routing": "456","doc": {"field1" : "value1"}}}`
@@ -322,3 +324,98 @@ func TestEndToEnd(t *testing.T) {
 	doc, _ := res.Hits.Hits[0].Source.MarshalJSON()
 	assert.Equal(t, `{"field1":"value1","field2":"value2"}`, string(doc))
 }
+
+func TestDeduplicator(t *testing.T) {
+	client := newRedisClient(redisUrl())
+	client.FlushAll()
+
+	counters := NewCounters()
+	recorder := []string{}
+	writer := newDeduplicator(client, "myQueue", time.Minute, counters).wrap(func(req *Request) error {
+		recorder = append(recorder, req.IdempotencyKey)
+
+		return nil
+	})
+
+	m1 := `{"type": "update", "idempotency_key": "k1", "update": {"index": "lr", "id": "123", "doc": {"field1": "value1"}}}`
+	m2 := `{"type": "update", "update": {"index": "lr", "id": "123", "doc": {"field2": "value2"}}}`
+	for _, raw := range []string{m1, m1, m2, m2} {
+		req, _ := fromBytes(raw)
+		if err := writer(req); nil != err {
+			t.Error(err)
+			t.FailNow()
+		}
+	}
+
+	// requests without idempotency key are never skipped
+	assert.Equal(t, []string{"k1", "", ""}, recorder)
+	assert.Equal(t, int64(1), counters.Get("dedup.hits"))
+
+	// Elastic Search failed to apply the request, producer can retry it.
+	dedup := newDeduplicator(client, "myQueue", time.Minute, counters)
+	req, _ := fromBytes(m1)
+	assert.NoError(t, dedup.wrap(func(req *Request) error { return nil })(req))
+	dedup.forget(*req)
+	assert.Equal(t, int64(1), counters.Get("dedup.forgotten"))
+
+	req, _ = fromBytes(m1)
+	assert.NoError(t, writer(req))
+	assert.Equal(t, []string{"k1", "", "", "k1"}, recorder)
+}
+
+func TestFailedRequests(t *testing.T) {
+	r1 := Request{Type: "delete", Delete: Delete{Index: "lr", Id: "1"}, idempotencyKeys: []string{"k1"}}
+	r2 := Request{Type: "delete", Delete: Delete{Index: "lr", Id: "2"}, idempotencyKeys: []string{"k2"}}
+	requests := []elastic.BulkableRequest{r1, r2}
+
+	response := &elastic.BulkResponse{Items: []map[string]*elastic.BulkResponseItem{
+		{"delete": {Index: "lr", Id: "1", Status: 200}},
+		{"delete": {Index: "lr", Id: "2", Status: 503, Error: &elastic.ErrorDetails{Type: "unavailable_shards_exception"}}},
+	}}
+
+	assert.Equal(t, []Request{r2}, failedRequests(requests, response, nil))
+	assert.Equal(t, []Request{r1, r2}, failedRequests(requests, nil, fmt.Errorf("timeout")), "whole bulk failed")
+}
+
+func TestRequest_ToBulkUpdateScript(t *testing.T) {
+	req, err := fromBytes(`
+		{
+			"type": "update",
+			"update": {
+				"index": "lr",
+				"id":    "123",
+				"script": { "source": "ctx._source.counter += params.count", "lang": "painless", "params": { "count": 4 } },
+				"upsert": { "counter" : 1 }
+			}
+		}
+	`)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	output, _ := req.Source()
+	assert.Equal(t, `{"script":{"lang":"painless","params":{"count":4},"source":"ctx._source.counter += params.count"},"scripted_upsert":false,"upsert":{"counter":1}}`, output[1])
+
+	// short form
+	req, _ = fromBytes(`{"type": "update", "update": {"index": "lr", "id": "123", "script": "ctx._source.counter++"}}`)
+	output, _ = req.Source()
+	assert.Equal(t, `{"script":{"source":"ctx._source.counter++"},"scripted_upsert":false}`, output[1])
+}
+
+func TestQueue_Reject(t *testing.T) {
+	client := newRedisClient(redisUrl())
+	client.FlushAll()
+
+	queue, _ := newQueue(client, "myQueue")
+	if err := queue.Reject(`{"type": "index"}`, "invalid document"); nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	item := map[string]string{}
+	_ = json.Unmarshal([]byte(client.LPop("myQueue-rejected").Val()), &item)
+	assert.Equal(t, `{"type": "index"}`, item["payload"])
+	assert.Equal(t, "invalid document", item["reason"])
+}
@@ -2,11 +2,21 @@ package redes_writer
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-type listener struct{}
+// interval of checking for deferred requests which are due.
+const deferredInterval = 100 * time.Millisecond
+
+type listener struct {
+	throttling bool          // rate limits are configured, deferred requests are released
+	gate       *gate         // optional, released after processing each message
+	done       chan struct{} // optional, closed when listening stopped
+}
 
 func newListener() Listener {
 	return &listener{}
@@ -16,25 +26,215 @@ func (l *listener) Run(ctx context.Context, errCh chan error, q Queue, writer Wr
 	ch := q.Listen(ctx, errCh)
 
 	go func(ctx context.Context) {
-		for {
-			raw := <-ch
-			req, err := fromBytes(raw)
-			if err != nil {
-				errCh <- err
-			}
+		if nil != l.done {
+			defer close(l.done)
+		}
 
-			err = writer(req)
-			if err != nil {
-				errCh <- err
-			}
+		var due <-chan time.Time
+		if l.throttling {
+			ticker := time.NewTicker(deferredInterval)
+			defer ticker.Stop()
+			due = ticker.C
+		}
 
+		for {
 			select {
-			case <-ctx.Done():
-				logrus.Infoln("cancelled 🐰 listening")
-			default: // just continue
+			case raw, ok := <-ch:
+				if !ok {
+					logrus.Infoln("cancelled 🐰 listening")
+
+					return
+				}
+
+				l.process(ctx, errCh, q, writer, raw, false)
+				l.gate.release()
+
+			case <-due:
+				l.releaseDeferred(ctx, errCh, q, writer)
 			}
 		}
 	}(ctx)
 
 	return nil
 }
+
+// releaseDeferred writes deferred requests which are due, in order.
+func (l *listener) releaseDeferred(ctx context.Context, errCh chan error, q Queue, writer Writer) {
+	for l.gate.open() && nil == ctx.Err() {
+		l.gate.acquire()
+		raw, ok, err := q.Due(time.Now())
+		if nil != err || !ok {
+			l.gate.release()
+			if nil != err {
+				errCh <- &QueueError{Err: err}
+			}
+
+			return
+		}
+
+		l.process(ctx, errCh, q, writer, raw, true)
+		l.gate.release()
+	}
+}
+
+// process writes one message from the queue.
+func (l *listener) process(ctx context.Context, errCh chan error, q Queue, writer Writer, raw string, throttled bool) {
+	req, err := fromBytes(raw)
+	if err != nil {
+		// message can never be written, move it out of the way.
+		errCh <- &ParseError{Raw: raw, Err: err}
+		if err := q.Reject(raw, "invalid message: "+err.Error()); nil != err {
+			errCh <- &QueueError{Raw: raw, Err: err}
+		}
+
+		return
+	}
+
+	req.throttled = throttled
+	if err := writer(req); err != nil {
+		err := withRaw(err, raw)
+		switch err := err.(type) {
+		case *ThrottleError:
+			// request is written when it's due, without holding the listener.
+			if deferErr := q.Defer(raw, err.Until); nil != deferErr {
+				err.cancel()
+				errCh <- &QueueError{Raw: raw, Err: deferErr}
+				if requeueErr := q.Requeue(raw); nil != requeueErr {
+					errCh <- &QueueError{Raw: raw, Err: requeueErr}
+				}
+			}
+
+			return
+
+		case *ValidationError:
+			// request can never be written, move it out of the way.
+			if rejectErr := q.Reject(raw, err.Error()); nil != rejectErr {
+				errCh <- &QueueError{Raw: raw, Err: rejectErr}
+			}
+
+		case *RetryError:
+			// request is written again, including to clusters which already
+			// received it.
+			if requeueErr := q.Requeue(raw); nil != requeueErr {
+				errCh <- &QueueError{Raw: raw, Err: requeueErr}
+			}
+		}
+
+		errCh <- err
+	}
+}
+
+// gate pauses dequeueing, without losing requests: queue stops popping
+// messages while gate is closed. Messages are in flight from popping until
+// listener has processed them.
+type gate struct {
+	inflight int32
+	mu       sync.Mutex
+	paused   bool
+	pausedAt time.Time
+	openCh   chan struct{} // closed while gate is open
+	resumed  chan struct{}
+}
+
+func newGate() *gate {
+	g := &gate{openCh: make(chan struct{}), resumed: make(chan struct{}, 1)}
+	close(g.openCh)
+
+	return g
+}
+
+func (g *gate) pause() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.paused {
+		g.paused = true
+		g.pausedAt = time.Now()
+		g.openCh = make(chan struct{})
+	}
+}
+
+func (g *gate) resume() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.paused {
+		g.paused = false
+		close(g.openCh)
+
+		select {
+		case g.resumed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// wait blocks while gate is closed, returns false when ctx is cancelled.
+func (g *gate) wait(ctx context.Context) bool {
+	if nil == g {
+		return true
+	}
+
+	g.mu.Lock()
+	openCh := g.openCh
+	g.mu.Unlock()
+
+	// cancelled listener stops dequeueing, even when gate is open.
+	if nil != ctx.Err() {
+		return false
+	}
+
+	select {
+	case <-openCh:
+		return true
+
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// resumptions signals when gate is opened again, nil channel without gate.
+func (g *gate) resumptions() chan struct{} {
+	if nil == g {
+		return nil
+	}
+
+	return g.resumed
+}
+
+// acquire counts message popped from the queue.
+func (g *gate) acquire() {
+	if nil != g {
+		atomic.AddInt32(&g.inflight, 1)
+	}
+}
+
+// release counts message which is processed, or was not popped.
+func (g *gate) release() {
+	if nil != g {
+		atomic.AddInt32(&g.inflight, -1)
+	}
+}
+
+// open tells whether dequeueing is allowed, always true without gate.
+func (g *gate) open() bool {
+	if nil == g {
+		return true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return !g.paused
+}
+
+func (g *gate) idle() bool {
+	return 0 == atomic.LoadInt32(&g.inflight)
+}
+
+func (g *gate) state() (bool, time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.paused, g.pausedAt
+}
@@ -0,0 +1,177 @@
+package redes_writer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"path"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Chain composes middlewares, first middleware is the outermost: it's called
+// first and wraps all others.
+func Chain(middlewares ...Middleware) Middleware {
+	return func(writer Writer) Writer {
+		for i := len(middlewares) - 1; i >= 0; i-- {
+			writer = middlewares[i](writer)
+		}
+
+		return writer
+	}
+}
+
+// newMiddlewares builds middlewares declared in configuration, in order.
+func newMiddlewares(configs []MiddlewareConfig, counters *Counters) ([]Middleware, error) {
+	middlewares := []Middleware{}
+	for i, cnf := range configs {
+		if "" != cnf.Match.Index {
+			if _, err := path.Match(cnf.Match.Index, ""); nil != err {
+				return nil, fmt.Errorf("middlewares[%d]: invalid index pattern %q", i, cnf.Match.Index)
+			}
+		}
+
+		name := cnf.Name
+		if "" == name {
+			name = cnf.Type
+		}
+
+		var middleware Middleware
+		switch cnf.Type {
+		case "logging":
+			level := logrus.DebugLevel
+			if "" != cnf.Level {
+				var err error
+				if level, err = logrus.ParseLevel(cnf.Level); nil != err {
+					return nil, fmt.Errorf("middlewares[%d]: %s", i, err)
+				}
+			}
+
+			middleware = LoggingMiddleware(level)
+
+		case "metrics":
+			middleware = MetricsMiddleware(name, counters)
+
+		case "filter":
+			if (MatchConfig{}) == cnf.Match {
+				return nil, fmt.Errorf("middlewares[%d]: filter must match some requests", i)
+			}
+
+			// drops matching requests.
+			middleware = FilterMiddleware(func(req *Request) bool { return false }, name, counters)
+
+		case "sample":
+			if cnf.Rate <= 0 || cnf.Rate > 1 {
+				return nil, fmt.Errorf("middlewares[%d]: sample rate must be in (0, 1]", i)
+			}
+
+			middleware = SampleMiddleware(cnf.Rate, name, counters)
+
+		default:
+			return nil, fmt.Errorf("middlewares[%d]: unknown middleware %q", i, cnf.Type)
+		}
+
+		middlewares = append(middlewares, onlyMatching(cnf.Match, middleware))
+	}
+
+	return middlewares, nil
+}
+
+// onlyMatching applies middleware to matching requests, others skip it.
+func onlyMatching(match MatchConfig, middleware Middleware) Middleware {
+	if (MatchConfig{}) == match {
+		return middleware
+	}
+
+	return func(writer Writer) Writer {
+		wrapped := middleware(writer)
+
+		return func(req *Request) error {
+			if nil != req && match.matches(req) {
+				return wrapped(req)
+			}
+
+			return writer(req)
+		}
+	}
+}
+
+// LoggingMiddleware logs each request & result of writing it.
+func LoggingMiddleware(level logrus.Level) Middleware {
+	return func(writer Writer) Writer {
+		return func(req *Request) error {
+			if nil == req {
+				return writer(req)
+			}
+
+			start := time.Now()
+			err := writer(req)
+			entry := logrus.
+				WithField("type", req.Type).
+				WithField("index", req.indexName()).
+				WithField("key", req.key()).
+				WithField("duration", time.Since(start).String())
+
+			if nil != err {
+				entry.WithError(err).Log(level, "failed to write request")
+			} else {
+				entry.Log(level, "request written")
+			}
+
+			return err
+		}
+	}
+}
+
+// MetricsMiddleware counts requests by type & failures.
+func MetricsMiddleware(name string, counters *Counters) Middleware {
+	return func(writer Writer) Writer {
+		return func(req *Request) error {
+			if nil == req {
+				return writer(req)
+			}
+
+			counters.Add("middleware."+name+".requests", 1)
+			counters.Add("middleware."+name+"."+req.Type, 1)
+
+			err := writer(req)
+			if nil != err {
+				counters.Add("middleware."+name+".errors", 1)
+			}
+
+			return err
+		}
+	}
+}
+
+// FilterMiddleware drops requests for which keep returns false.
+func FilterMiddleware(keep func(req *Request) bool, name string, counters *Counters) Middleware {
+	return func(writer Writer) Writer {
+		return func(req *Request) error {
+			if nil != req && !keep(req) {
+				counters.Add("middleware."+name+".dropped", 1)
+
+				return nil
+			}
+
+			return writer(req)
+		}
+	}
+}
+
+// SampleMiddleware keeps a fraction of requests. Requests to a document are
+// sampled by its key, so that all requests to a sampled document are kept.
+func SampleMiddleware(rate float64, name string, counters *Counters) Middleware {
+	return FilterMiddleware(func(req *Request) bool {
+		if key := req.key(); "" != key {
+			sum := sha256.Sum256([]byte(key))
+
+			return float64(binary.BigEndian.Uint64(sum[:8]))/math.MaxUint64 < rate
+		}
+
+		return rand.Float64() < rate
+	}, name, counters)
+}
@@ -0,0 +1,98 @@
+package redes_writer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	calls := []string{}
+	named := func(name string) Middleware {
+		return func(writer Writer) Writer {
+			return func(req *Request) error {
+				calls = append(calls, name)
+
+				return writer(req)
+			}
+		}
+	}
+
+	writer := Chain(named("a"), named("b"), named("c"))(func(req *Request) error {
+		calls = append(calls, "writer")
+
+		return nil
+	})
+
+	assert.NoError(t, writer(&Request{}))
+	assert.Equal(t, []string{"a", "b", "c", "writer"}, calls)
+}
+
+func TestNewMiddlewares(t *testing.T) {
+	counters := NewCounters()
+	middlewares, err := newMiddlewares([]MiddlewareConfig{
+		{Type: "logging", Level: "info"},
+		{Type: "metrics", Name: "in"},
+		{Type: "filter", Name: "no-tmp", Match: MatchConfig{Index: "tmp-*"}},
+		{Type: "sample", Name: "audit", Match: MatchConfig{Index: "audit"}, Rate: 0.5},
+		{Type: "metrics", Name: "out"},
+	}, counters)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	written := map[string]int{}
+	writer := Chain(middlewares...)(func(req *Request) error {
+		written[req.indexName()]++
+		if "fail" == req.indexName() {
+			return fmt.Errorf("failed")
+		}
+
+		return nil
+	})
+
+	for i := 0; i < 100; i++ {
+		for _, index := range []string{"lr", "tmp-1", "audit"} {
+			req, _ := fromBytes(fmt.Sprintf(`{"type": "index", "index": {"index": "%s", "id": "%d"}}`, index, i))
+			assert.NoError(t, writer(req))
+		}
+	}
+
+	fail, _ := fromBytes(`{"type": "delete", "delete": {"index": "fail", "id": "1"}}`)
+	assert.Error(t, writer(fail))
+
+	assert.Equal(t, 100, written["lr"])
+	assert.Equal(t, 0, written["tmp-1"])
+	assert.InDelta(t, 50, written["audit"], 20)
+
+	assert.Equal(t, int64(301), counters.Get("middleware.in.requests"))
+	assert.Equal(t, int64(300), counters.Get("middleware.in.index"))
+	assert.Equal(t, int64(1), counters.Get("middleware.in.delete"))
+	assert.Equal(t, int64(1), counters.Get("middleware.in.errors"))
+	assert.Equal(t, int64(100), counters.Get("middleware.no-tmp.dropped"))
+	assert.Equal(t, int64(100-written["audit"]), counters.Get("middleware.audit.dropped"))
+	assert.Equal(t, int64(101+written["audit"]), counters.Get("middleware.out.requests"))
+
+	// same document is always sampled the same way.
+	req, _ := fromBytes(`{"type": "index", "index": {"index": "audit", "id": "1"}}`)
+	before := written["audit"]
+	for i := 0; i < 10; i++ {
+		_ = writer(req)
+	}
+
+	assert.Contains(t, []int{before, before + 10}, written["audit"])
+}
+
+func TestNewMiddlewares_Invalid(t *testing.T) {
+	_, err := newMiddlewares([]MiddlewareConfig{{Type: "filter"}}, NewCounters())
+	assert.EqualError(t, err, "middlewares[0]: filter must match some requests")
+
+	_, err = newMiddlewares([]MiddlewareConfig{{Type: "sample", Rate: 2}}, NewCounters())
+	assert.EqualError(t, err, "middlewares[0]: sample rate must be in (0, 1]")
+
+	_, err = newMiddlewares([]MiddlewareConfig{{Type: "cache"}}, NewCounters())
+	assert.EqualError(t, err, `middlewares[0]: unknown middleware "cache"`)
+}
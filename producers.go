@@ -0,0 +1,148 @@
+package redes_writer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// name used in statistics for messages which are not wrapped in envelope.
+const anonymousProducer = "anonymous"
+
+// authorizer verifies signatures of producers and rejects requests to indices
+// or of types which the producer is not allowed to write.
+type authorizer struct {
+	required  bool
+	producers map[string]ProducerConfig
+	counters  *Counters
+}
+
+func newAuthorizer(required bool, configs []ProducerConfig, counters *Counters) (*authorizer, error) {
+	a := &authorizer{required: required, producers: map[string]ProducerConfig{}, counters: counters}
+	for i, cnf := range configs {
+		if "" == cnf.Name || "" == cnf.Key {
+			return nil, fmt.Errorf("auth.producers[%d]: missing name or key", i)
+		}
+
+		if _, ok := a.producers[cnf.Name]; ok {
+			return nil, fmt.Errorf("auth.producers[%d]: duplicate producer %s", i, cnf.Name)
+		}
+
+		a.producers[cnf.Name] = cnf
+	}
+
+	return a, nil
+}
+
+// wrap returns a writer which only writes authorized requests.
+func (a *authorizer) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req {
+			if err := a.check(req); nil != err {
+				producer := req.producer
+				if "" == producer {
+					producer = anonymousProducer
+				}
+
+				a.counters.Add("producer."+producer+".rejected", 1)
+
+				return reject(err)
+			}
+		}
+
+		return writer(req)
+	}
+}
+
+func (a *authorizer) check(req *Request) error {
+	if "" == req.producer {
+		if a.required {
+			return fmt.Errorf("message is not signed by a producer")
+		}
+
+		return nil
+	}
+
+	cnf, ok := a.producers[req.producer]
+	if !ok {
+		return fmt.Errorf("unknown producer %s", req.producer)
+	}
+
+	mac := hmac.New(sha256.New, []byte(cnf.Key))
+	_, _ = mac.Write(req.payload)
+	signature, err := hex.DecodeString(req.signature)
+	if nil != err || !hmac.Equal(signature, mac.Sum(nil)) {
+		return fmt.Errorf("invalid signature of producer %s", req.producer)
+	}
+
+	if len(cnf.Types) > 0 && !contains(cnf.Types, req.Type) {
+		return fmt.Errorf("producer %s is not allowed to %s", req.producer, req.Type)
+	}
+
+	if 0 == len(cnf.Indices) {
+		return nil
+	}
+
+	for _, index := range requestIndices(req) {
+		allowed := false
+		for _, pattern := range cnf.Indices {
+			if "" != pattern && matchIndex(pattern, index) {
+				allowed = true
+				break
+			}
+		}
+
+		if !allowed {
+			return fmt.Errorf("producer %s is not allowed to write to %s", req.producer, index)
+		}
+	}
+
+	return nil
+}
+
+// requestIndices lists all indices & aliases which request writes to, comma
+// separated lists are split, Elastic Search accepts them in most requests.
+func requestIndices(req *Request) []string {
+	var names []string
+	switch req.Type {
+	case "create_index":
+		names = []string{req.CreateIndex.Index}
+
+	case "put_alias":
+		names = []string{req.PutAlias.Index, req.PutAlias.Alias}
+
+	case "swap_alias":
+		names = []string{req.SwapAlias.Alias, req.SwapAlias.From, req.SwapAlias.To}
+
+	case "refresh":
+		names = []string{req.Refresh.Index}
+
+	case "delete_index":
+		names = []string{req.DeleteIndex.Index}
+
+	case "update_by_query":
+		names = []string{req.UpdateByQuery.Index}
+
+	case "delete_by_query":
+		names = []string{req.DeleteByQuery.Index}
+
+	default:
+		names = []string{req.indexName()}
+	}
+
+	indices := []string{}
+	for _, name := range strings.Split(strings.Join(names, ","), ",") {
+		if name = strings.TrimSpace(name); "" != name {
+			indices = append(indices, name)
+		}
+	}
+
+	// nothing to check against the allowlist, e.g. invalid request, must not pass.
+	if 0 == len(indices) {
+		indices = append(indices, "")
+	}
+
+	return indices
+}
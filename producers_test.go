@@ -0,0 +1,97 @@
+package redes_writer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorizer(t *testing.T) {
+	counters := NewCounters()
+	a, err := newAuthorizer(true, []ProducerConfig{
+		{Name: "billing", Key: "secret", Indices: []string{"billing-*"}, Types: []string{"index", "delete"}},
+	}, counters)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	sign := func(producer string, key string, request string) *Request {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(request))
+		req, err := fromBytes(`{"producer": "` + producer + `", "signature": "` + hex.EncodeToString(mac.Sum(nil)) + `", "request": ` + request + `}`)
+		if nil != err {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		return req
+	}
+
+	written := 0
+	writer := a.wrap(func(req *Request) error {
+		written++
+
+		return nil
+	})
+
+	req := sign("billing", "secret", `{"type": "index", "index": {"index": "billing-2026", "id": "1", "doc": {}}}`)
+	assert.Equal(t, "billing-2026", req.Index.Index)
+	assert.NoError(t, writer(req))
+
+	rejected := map[string]*Request{
+		"invalid signature of producer billing":               sign("billing", "wrong", `{"type": "index", "index": {"index": "billing-2026"}}`),
+		"unknown producer crm":                                sign("crm", "secret", `{"type": "index", "index": {"index": "billing-2026"}}`),
+		"producer billing is not allowed to write to crm":     sign("billing", "secret", `{"type": "delete", "delete": {"index": "crm", "id": "1"}}`),
+		"producer billing is not allowed to delete_index":     sign("billing", "secret", `{"type": "delete_index", "delete_index": {"index": "billing-2026"}}`),
+		"producer billing is not allowed to write to billing": sign("billing", "secret", `{"type": "index", "index": {"index": "billing"}}`),
+	}
+
+	for reason, req := range rejected {
+		err := writer(req)
+		assert.IsType(t, &ValidationError{}, err)
+		assert.EqualError(t, err, reason)
+	}
+
+	anonymous, _ := fromBytes(`{"type": "index", "index": {"index": "billing-2026"}}`)
+	assert.EqualError(t, writer(anonymous), "message is not signed by a producer")
+
+	assert.Equal(t, 1, written)
+	assert.Equal(t, int64(4), counters.Get("producer.billing.rejected"))
+	assert.Equal(t, int64(1), counters.Get("producer.crm.rejected"))
+	assert.Equal(t, int64(1), counters.Get("producer.anonymous.rejected"))
+
+	// every index of comma separated lists is checked.
+	ops, _ := newAuthorizer(true, []ProducerConfig{{Name: "ops", Key: "secret", Indices: []string{"billing-*"}}}, counters)
+	writer = ops.wrap(func(req *Request) error { return nil })
+	assert.NoError(t, writer(sign("ops", "secret", `{"type": "refresh", "refresh": {"index": "billing-1,billing-2"}}`)))
+	for _, request := range []string{
+		`{"type": "delete_index", "delete_index": {"index": "billing-1,crm"}}`,
+		`{"type": "create_index", "create_index": {"index": "billing-1,crm"}}`,
+		`{"type": "put_alias", "put_alias": {"index": "billing-1,crm", "alias": "billing-all"}}`,
+		`{"type": "refresh", "refresh": {"index": "billing-1, crm"}}`,
+	} {
+		assert.EqualError(t, writer(sign("ops", "secret", request)), "producer ops is not allowed to write to crm", request)
+	}
+}
+
+func TestRequestIndices(t *testing.T) {
+	req, _ := fromBytes(`{"type": "swap_alias", "swap_alias": {"alias": "lr", "from": "lr-1", "to": "lr-2"}}`)
+	assert.Equal(t, []string{"lr", "lr-1", "lr-2"}, requestIndices(req))
+
+	req, _ = fromBytes(`{"type": "delete_by_query", "delete_by_query": {"index": "lr-1, lr-2"}}`)
+	assert.Equal(t, []string{"lr-1", "lr-2"}, requestIndices(req))
+
+	req, _ = fromBytes(`{"type": "delete_index", "delete_index": {"index": "billing-1,crm"}}`)
+	assert.Equal(t, []string{"billing-1", "crm"}, requestIndices(req))
+
+	req, _ = fromBytes(`{"type": "put_alias", "put_alias": {"index": "billing-1,crm", "alias": "billing"}}`)
+	assert.Equal(t, []string{"billing-1", "crm", "billing"}, requestIndices(req))
+
+	req, _ = fromBytes(`{"type": "refresh", "refresh": {}}`)
+	assert.Equal(t, []string{""}, requestIndices(req))
+}
@@ -2,18 +2,27 @@ package redes_writer
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-redis/redis"
 )
 
+// redis is retried every second, es-writer gives up after this many failures.
+const maxQueueRetries = 30
+
 type queue struct {
 	name    string
 	client  *redis.Client
 	ps      *redis.PubSub
 	timeout time.Duration
+	gate    *gate // optional, pauses dequeueing
+	subs    *sync.WaitGroup
 }
 
 func (q queue) Name() string {
@@ -24,12 +33,21 @@ func (q queue) pubsubChanel() string {
 	return q.Name() + "-pubsub"
 }
 
+func (q queue) rejectedName() string {
+	return q.Name() + "-rejected"
+}
+
+func (q queue) deferredName() string {
+	return q.Name() + "-deferred"
+}
+
 func newQueue(client *redis.Client, name string) (*queue, error) {
 	q := &queue{
 		name:    name,
 		client:  client,
 		ps:      nil,
 		timeout: 3 * time.Second,
+		subs:    &sync.WaitGroup{},
 	}
 
 	q.ps = client.Subscribe(q.pubsubChanel())
@@ -58,27 +76,36 @@ func (q queue) Listen(ctx context.Context, errCh chan error) chan string {
 
 	defer func() {
 		if err := recover(); err != nil {
-			errCh <- fmt.Errorf("es-writer is broken: %s", err)
+			errCh <- &QueueError{Err: fmt.Errorf("es-writer is broken: %s", err), Fatal: true}
 		}
 	}()
 
-	go q.loop(ctx, q.sub(ctx, errCh), ch)
+	go q.loop(ctx, q.sub(ctx, errCh), ch, errCh)
 
 	return ch
 }
 
-func (q *queue) loop(ctx context.Context, sub chan string, ch chan string) {
+func (q *queue) loop(ctx context.Context, sub chan string, ch chan string, errCh chan error) {
 	for { // run forever
 		for { // process all items in queue
+			if !q.gate.wait(ctx) {
+				close(ch)
+				return
+			}
+
+			q.gate.acquire()
 			result, err := q.client.LPop(q.Name()).Result()
-			if nil != err {
-				if err.Error() != "redis: nil" {
-					panic(err)
-				}
+			if nil != err && err.Error() != "redis: nil" {
+				q.gate.release()
+				report(ctx, errCh, &QueueError{Err: err})
+
+				// retry when redis is back, or on next signal.
+				break
 			}
 
 			// queue is now empty, don't need fetching it again
 			if 0 == len(result) {
+				q.gate.release()
 				break
 			} else {
 				ch <- result
@@ -92,6 +119,9 @@ func (q *queue) loop(ctx context.Context, sub chan string, ch chan string) {
 
 		case <-sub: // wait for signal form ps channel
 			continue
+
+		case <-q.gate.resumptions(): // items may be waiting since paused
+			continue
 		}
 	}
 }
@@ -99,34 +129,68 @@ func (q *queue) loop(ctx context.Context, sub chan string, ch chan string) {
 func (q queue) sub(ctx context.Context, errCh chan error) chan string {
 	ch := make(chan string, 1)
 
+	q.subs.Add(1)
 	go func() {
+		defer q.subs.Done()
+
+		failures := 0
 		for {
 			msg, err := q.ps.ReceiveMessage()
+			if nil != ctx.Err() {
+				return // pubsub is closed.
+			}
+
 			if nil != err {
-				errCh <- err
+				failures++
+				report(ctx, errCh, &QueueError{Err: err, Fatal: failures >= maxQueueRetries})
+				time.Sleep(time.Second)
+
+				continue
 			}
 
+			failures = 0
+
 			// we may have too many signal in ps channel
 			// we should send-out only one
 			// q.ps.ReceiveTimeout()
-			for {
+			for nil == ctx.Err() {
 				_, err := q.ps.ReceiveTimeout(time.Second)
 				if err != nil {
 					if strings.Contains(err.Error(), "i/o timeout") {
 						break
 					} else {
-						errCh <- err
+						report(ctx, errCh, &QueueError{Err: err})
 					}
 				}
 			}
 
-			ch <- msg.Payload
+			select {
+			case ch <- msg.Payload:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 
 	return ch
 }
 
+// Close closes the pubsub connection, after listening is cancelled.
+func (q queue) Close() error {
+	err := q.ps.Close()
+	q.subs.Wait()
+
+	return err
+}
+
+// report sends err to errCh, unless listening is cancelled meanwhile.
+func report(ctx context.Context, errCh chan error, err error) {
+	select {
+	case errCh <- err:
+	case <-ctx.Done():
+	}
+}
+
 func (q queue) CountItems() int64 {
 	cmd := q.client.LLen(q.name)
 	if cmd.Err() != nil {
@@ -135,3 +199,56 @@ func (q queue) CountItems() int64 {
 
 	return cmd.Val()
 }
+
+func (q queue) Reject(payload string, reason string) error {
+	item, err := json.Marshal(map[string]interface{}{
+		"payload":    payload,
+		"reason":     reason,
+		"rejectedAt": time.Now().UTC().Format(time.RFC3339),
+	})
+
+	if nil != err {
+		return err
+	}
+
+	return q.client.RPush(q.rejectedName(), item).Err()
+}
+
+func (q queue) Requeue(payload string) error {
+	return q.client.LPush(q.Name(), payload).Err()
+}
+
+// sequence of deferred requests, keeps order of requests which are due at
+// the same time.
+var deferredSeq = time.Now().UnixNano()
+
+// Defer keeps request in a sorted set, scored by the time it's due.
+func (q queue) Defer(payload string, until time.Time) error {
+	member := fmt.Sprintf("%016x:%s", atomic.AddInt64(&deferredSeq, 1), payload)
+
+	return q.client.ZAdd(q.deferredName(), redis.Z{Score: float64(until.UnixNano() / int64(time.Millisecond)), Member: member}).Err()
+}
+
+func (q queue) Due(now time.Time) (string, bool, error) {
+	members, err := q.client.ZRangeByScore(q.deferredName(), redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(now.UnixNano()/int64(time.Millisecond), 10),
+		Count: 1,
+	}).Result()
+
+	if nil != err {
+		return "", false, err
+	}
+
+	for _, member := range members {
+		// request may be taken by other es-writer listening on the same queue.
+		removed, err := q.client.ZRem(q.deferredName(), member).Result()
+		if nil != err || 0 == removed {
+			return "", false, err
+		}
+
+		return member[strings.Index(member, ":")+1:], true, nil
+	}
+
+	return "", false, nil
+}
@@ -0,0 +1,206 @@
+package redes_writer
+
+import (
+	"github.com/go-redis/redis"
+)
+
+const (
+	defaultPeekSize   = 10
+	maxPeekSize       = 1000
+	defaultSampleSize = 1000
+	maxSampleSize     = 10000
+	defaultScanSize   = 10000
+	maxScanSize       = 100000
+	scanChunkSize     = 1000
+)
+
+type (
+	// QueueItem describes a message pending in the queue, Position 0 is the
+	// next message to be dequeued. Documents are never included, queue
+	// endpoints of admin API are not authenticated.
+	QueueItem struct {
+		Position int64    `json:"position"`
+		Type     string   `json:"type,omitempty"`
+		Indices  []string `json:"indices,omitempty"`
+		Id       string   `json:"id,omitempty"`
+		Producer string   `json:"producer,omitempty"`
+		Size     int      `json:"size"`            // of the raw message, in bytes
+		Error    string   `json:"error,omitempty"` // why message is invalid
+	}
+
+	// QueueSummary counts pending requests by index & type. Large queues are
+	// sampled, counts are of the sampled messages.
+	QueueSummary struct {
+		Total   int64                     `json:"total"`
+		Sampled int                       `json:"sampled"`
+		Invalid int                       `json:"invalid"`
+		ByType  map[string]int            `json:"byType"`
+		ByIndex map[string]map[string]int `json:"byIndex"` // index » type » count
+	}
+
+	// QueueSearch is the result of looking up requests to a document.
+	QueueSearch struct {
+		Total   int64       `json:"total"`
+		Scanned int64       `json:"scanned"`
+		Items   []QueueItem `json:"items"`
+	}
+)
+
+// boundSize returns size, or def when size is not given, at most max.
+func boundSize(size int, def int, max int) int {
+	if size <= 0 {
+		return def
+	}
+
+	return minInt(size, max)
+}
+
+func newQueueItem(position int64, raw string) QueueItem {
+	item := QueueItem{Position: position, Size: len(raw)}
+
+	req, err := fromBytes(raw)
+	if nil != err {
+		item.Error = err.Error()
+
+		return item
+	}
+
+	item.Type, item.Indices, item.Id, item.Producer = req.Type, requestIndices(req), req.id(), req.producer
+
+	return item
+}
+
+// peekQueue returns first n messages of the queue, or last n when tail.
+func peekQueue(client *redis.Client, name string, tail bool, n int) ([]QueueItem, error) {
+	n = boundSize(n, defaultPeekSize, maxPeekSize)
+
+	start, stop := int64(0), int64(n-1)
+	if tail {
+		start, stop = int64(-n), -1
+	}
+
+	raws, err := client.LRange(name, start, stop).Result()
+	if nil != err {
+		return nil, err
+	}
+
+	offset := int64(0)
+	if tail {
+		total, err := client.LLen(name).Result()
+		if nil != err {
+			return nil, err
+		}
+
+		offset = total - int64(len(raws))
+	}
+
+	items := []QueueItem{}
+	for i, raw := range raws {
+		items = append(items, newQueueItem(offset+int64(i), raw))
+	}
+
+	return items, nil
+}
+
+// summarizeQueue counts pending requests, sampling messages evenly through
+// the queue when it's larger than sample.
+func summarizeQueue(client *redis.Client, name string, sample int) (QueueSummary, error) {
+	sample = boundSize(sample, defaultSampleSize, maxSampleSize)
+	summary := QueueSummary{ByType: map[string]int{}, ByIndex: map[string]map[string]int{}}
+
+	total, err := client.LLen(name).Result()
+	if nil != err {
+		return summary, err
+	}
+
+	summary.Total = total
+	raws := []string{}
+	if total <= int64(sample) {
+		if raws, err = client.LRange(name, 0, -1).Result(); nil != err {
+			return summary, err
+		}
+	} else {
+		cmds, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+			for i := int64(0); i < int64(sample); i++ {
+				pipe.LIndex(name, i*total/int64(sample))
+			}
+
+			return nil
+		})
+
+		// messages may be dequeued while sampling.
+		if nil != err && redis.Nil != err {
+			return summary, err
+		}
+
+		for _, cmd := range cmds {
+			if raw, err := cmd.(*redis.StringCmd).Result(); nil == err {
+				raws = append(raws, raw)
+			}
+		}
+	}
+
+	for _, raw := range raws {
+		summary.add(raw)
+	}
+
+	return summary, nil
+}
+
+func (s *QueueSummary) add(raw string) {
+	s.Sampled++
+
+	req, err := fromBytes(raw)
+	if nil != err {
+		s.Invalid++
+
+		return
+	}
+
+	s.ByType[req.Type]++
+	for _, index := range requestIndices(req) {
+		if nil == s.ByIndex[index] {
+			s.ByIndex[index] = map[string]int{}
+		}
+
+		s.ByIndex[index][req.Type]++
+	}
+}
+
+// findInQueue returns pending requests to document id, optionally in index,
+// scanning at most scan messages from head of the queue.
+func findInQueue(client *redis.Client, name string, id string, index string, scan int) (QueueSearch, error) {
+	scan = boundSize(scan, defaultScanSize, maxScanSize)
+	search := QueueSearch{Items: []QueueItem{}}
+
+	total, err := client.LLen(name).Result()
+	if nil != err {
+		return search, err
+	}
+
+	search.Total = total
+	for search.Scanned < int64(scan) {
+		start := search.Scanned
+		size := minInt(scanChunkSize, scan-int(start))
+		raws, err := client.LRange(name, start, start+int64(size)-1).Result()
+		if nil != err {
+			return search, err
+		}
+
+		for i, raw := range raws {
+			req, err := fromBytes(raw)
+			if nil != err || id != req.id() || ("" != index && index != req.indexName()) {
+				continue
+			}
+
+			search.Items = append(search.Items, newQueueItem(start+int64(i), raw))
+		}
+
+		search.Scanned += int64(len(raws))
+		if len(raws) < size {
+			break // end of queue.
+		}
+	}
+
+	return search, nil
+}
@@ -0,0 +1,103 @@
+package redes_writer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueueSummary_Add(t *testing.T) {
+	summary := QueueSummary{ByType: map[string]int{}, ByIndex: map[string]map[string]int{}}
+	summary.add(`{"type": "index", "index": {"index": "lr", "id": "1"}}`)
+	summary.add(`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`)
+	summary.add(`{"type": "delete_by_query", "delete_by_query": {"index": "lr,archive"}}`)
+	summary.add(`{"producer": "billing", "request": {"type": "update", "update": {"index": "invoices", "id": "2"}}}`)
+	summary.add(`invalid`)
+
+	assert.Equal(t, 5, summary.Sampled)
+	assert.Equal(t, 1, summary.Invalid)
+	assert.Equal(t, map[string]int{"index": 1, "delete": 1, "delete_by_query": 1, "update": 1}, summary.ByType)
+	assert.Equal(t, map[string]map[string]int{
+		"lr":       {"index": 1, "delete": 1, "delete_by_query": 1},
+		"archive":  {"delete_by_query": 1},
+		"invoices": {"update": 1},
+	}, summary.ByIndex)
+}
+
+func TestNewQueueItem(t *testing.T) {
+	raw := `{"producer": "billing", "request": {"type": "index", "index": {"index": "lr", "id": "1", "doc": {"email": "john@example.com"}}}}`
+	assert.Equal(t, QueueItem{
+		Position: 3,
+		Type:     "index",
+		Indices:  []string{"lr"},
+		Id:       "1",
+		Producer: "billing",
+		Size:     len(raw),
+	}, newQueueItem(3, raw), "documents are not exposed")
+
+	item := newQueueItem(0, `{"email": "john@example.com"`)
+	assert.Equal(t, 28, item.Size)
+	assert.NotEmpty(t, item.Error)
+	assert.NotContains(t, item.Error, "john@example.com")
+}
+
+func TestBoundSize(t *testing.T) {
+	assert.Equal(t, defaultPeekSize, boundSize(0, defaultPeekSize, maxPeekSize))
+	assert.Equal(t, 5, boundSize(5, defaultPeekSize, maxPeekSize))
+	assert.Equal(t, maxPeekSize, boundSize(maxPeekSize+1, defaultPeekSize, maxPeekSize))
+}
+
+func TestAdminHandler_QueueFind(t *testing.T) {
+	engine, err := NewEngine(Options{Config: &Config{}})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	res := httptest.NewRecorder()
+	NewAdminHandler(engine).ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/queue/find", nil))
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestQueueInspection(t *testing.T) {
+	client := newRedisClient(redisUrl())
+	client.FlushAll()
+
+	for i := 0; i < 30; i++ {
+		client.RPush("inspect", fmt.Sprintf(`{"type": "index", "index": {"index": "lr", "id": "%d"}}`, i%10))
+	}
+
+	client.RPush("inspect", `invalid`)
+
+	items, err := peekQueue(client, "inspect", false, 2)
+	assert.NoError(t, err)
+	assert.Len(t, items, 2)
+	assert.Equal(t, int64(1), items[1].Position)
+	assert.Equal(t, "1", items[1].Id)
+
+	items, err = peekQueue(client, "inspect", true, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(30), items[0].Position)
+	assert.NotEmpty(t, items[0].Error)
+
+	summary, err := summarizeQueue(client, "inspect", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(31), summary.Total)
+	assert.Equal(t, 30, summary.ByIndex["lr"]["index"])
+
+	summary, err = summarizeQueue(client, "inspect", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, summary.Sampled, "large queue is sampled")
+
+	search, err := findInQueue(client, "inspect", "3", "lr", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(31), search.Scanned)
+	assert.Len(t, search.Items, 3)
+	assert.Equal(t, int64(13), search.Items[1].Position)
+
+	search, err = findInQueue(client, "inspect", "3", "other", 0)
+	assert.NoError(t, err)
+	assert.Empty(t, search.Items)
+}
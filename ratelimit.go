@@ -0,0 +1,218 @@
+package redes_writer
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type (
+	// rateLimiter defers requests of indices or producers which are written
+	// faster than their token buckets allow. Deferred requests are kept in
+	// Redis until they're due, see Queue.Defer.
+	rateLimiter struct {
+		buckets  []*tokenBucket
+		counters *Counters
+		now      func() time.Time
+	}
+
+	tokenBucket struct {
+		mu       sync.Mutex
+		name     string
+		index    string
+		producer string
+		rate     float64
+		burst    float64
+		tokens   float64
+		updated  time.Time
+		waiting  int // deferred requests, not written yet
+	}
+
+	// RateLimit is state of one token bucket.
+	RateLimit struct {
+		Name     string  `json:"name"`
+		Index    string  `json:"index,omitempty"`
+		Producer string  `json:"producer,omitempty"`
+		Rate     float64 `json:"rate"`
+		Burst    float64 `json:"burst"`
+		Tokens   float64 `json:"tokens"`   // negative when requests are waiting
+		Deferred int     `json:"deferred"` // requests put aside until tokens are available
+	}
+)
+
+func newRateLimiter(configs []RateLimitConfig, counters *Counters) (*rateLimiter, error) {
+	l := &rateLimiter{counters: counters, now: time.Now}
+	for i, cnf := range configs {
+		if "" == cnf.Name {
+			return nil, fmt.Errorf("rateLimits[%d]: missing name", i)
+		}
+
+		if cnf.Rate <= 0 {
+			return nil, fmt.Errorf("rateLimits[%d]: rate must be positive", i)
+		}
+
+		burst := float64(cnf.Burst)
+		if burst <= 0 {
+			burst = math.Max(1, cnf.Rate)
+		}
+
+		l.buckets = append(l.buckets, &tokenBucket{
+			name:     cnf.Name,
+			index:    cnf.Index,
+			producer: cnf.Producer,
+			rate:     cnf.Rate,
+			burst:    burst,
+			tokens:   burst,
+		})
+	}
+
+	return l, nil
+}
+
+// wrap throttles requests after their index names are resolved & routes are
+// applied. Requests over the limits are deferred, not waited for, so that
+// requests of other indices are written meanwhile. Once a bucket has deferred
+// requests, following requests of the bucket are deferred too, to keep order.
+func (l *rateLimiter) wrap(next Writer) Writer {
+	if 0 == len(l.buckets) {
+		return next
+	}
+
+	return func(req *Request) error {
+		if req.throttled {
+			l.release(req)
+
+			return next(req)
+		}
+
+		if delay, deferred := l.reserve(req); deferred {
+			return &ThrottleError{Until: l.now().Add(delay), cancel: func() { l.release(req) }}
+		}
+
+		return next(req)
+	}
+}
+
+// reserve takes a token from all buckets matching the request. Request is
+// deferred by returned duration when a bucket has no token left, or when
+// a bucket has deferred requests.
+func (l *rateLimiter) reserve(req *Request) (time.Duration, bool) {
+	var delay time.Duration
+	deferred := false
+	now := l.now()
+	matched := []*tokenBucket{}
+	for _, bucket := range l.buckets {
+		if !bucket.matches(req) {
+			continue
+		}
+
+		matched = append(matched, bucket)
+		d, waiting := bucket.take(now)
+		if d > 0 {
+			l.counters.Add("ratelimit."+bucket.name+".throttled", 1)
+			if d > delay {
+				delay = d
+			}
+		}
+
+		deferred = deferred || d > 0 || waiting > 0
+	}
+
+	if deferred {
+		for _, bucket := range matched {
+			bucket.mu.Lock()
+			bucket.waiting++
+			bucket.mu.Unlock()
+		}
+	}
+
+	return delay, deferred
+}
+
+// release counts deferred request out of its buckets.
+func (l *rateLimiter) release(req *Request) {
+	for _, bucket := range l.buckets {
+		if bucket.matches(req) {
+			bucket.mu.Lock()
+			if bucket.waiting > 0 {
+				bucket.waiting--
+			}
+			bucket.mu.Unlock()
+		}
+	}
+}
+
+func (l *rateLimiter) state() []RateLimit {
+	now := l.now()
+	limits := make([]RateLimit, 0, len(l.buckets))
+	for _, bucket := range l.buckets {
+		bucket.mu.Lock()
+		bucket.refill(now)
+		limits = append(limits, RateLimit{
+			Name:     bucket.name,
+			Index:    bucket.index,
+			Producer: bucket.producer,
+			Rate:     bucket.rate,
+			Burst:    bucket.burst,
+			Tokens:   bucket.tokens,
+			Deferred: bucket.waiting,
+		})
+		bucket.mu.Unlock()
+	}
+
+	return limits
+}
+
+func (b *tokenBucket) matches(req *Request) bool {
+	if "" != b.producer && b.producer != req.producer {
+		return false
+	}
+
+	if "" == b.index {
+		return true
+	}
+
+	for _, index := range requestIndices(req) {
+		if matchIndex(b.index, index) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// take removes one token, tokens may go negative. Returned duration is how
+// long to wait until the token is actually available, with number of
+// requests already waiting.
+func (b *tokenBucket) take(now time.Time) (time.Duration, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, b.waiting
+	}
+
+	return time.Duration(-b.tokens / b.rate * float64(time.Second)), b.waiting
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	if !b.updated.IsZero() && now.After(b.updated) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.updated).Seconds()*b.rate)
+	}
+
+	b.updated = now
+}
+
+// setRate changes rate of the bucket, burst follows the rate.
+func (b *tokenBucket) setRate(rate float64, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(now)
+	b.rate = rate
+	b.burst = math.Max(1, rate)
+	b.tokens = math.Min(b.burst, b.tokens)
+}
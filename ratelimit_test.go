@@ -0,0 +1,118 @@
+package redes_writer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiter(t *testing.T) {
+	counters := NewCounters()
+	l, err := newRateLimiter([]RateLimitConfig{
+		{Name: "backfill", Index: "lr-*", Rate: 2, Burst: 2},
+		{Name: "billing", Producer: "billing", Rate: 10},
+	}, counters)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	now := time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	lr, _ := fromBytes(`{"type": "index", "index": {"index": "lr-1"}}`)
+	other, _ := fromBytes(`{"type": "index", "index": {"index": "other"}}`)
+
+	reserve := func(req *Request) []interface{} {
+		delay, deferred := l.reserve(req)
+
+		return []interface{}{delay, deferred}
+	}
+
+	assert.Equal(t, []interface{}{time.Duration(0), false}, reserve(lr))
+	assert.Equal(t, []interface{}{time.Duration(0), false}, reserve(lr))
+	assert.Equal(t, []interface{}{500 * time.Millisecond, true}, reserve(lr))
+	assert.Equal(t, []interface{}{time.Second, true}, reserve(lr))
+	assert.Equal(t, []interface{}{time.Duration(0), false}, reserve(other))
+
+	// tokens are refilled with time, but requests are deferred until deferred
+	// requests are written.
+	now = now.Add(2 * time.Second)
+	assert.Equal(t, []interface{}{time.Duration(0), true}, reserve(lr))
+	l.release(lr)
+	l.release(lr)
+	l.release(lr)
+	assert.Equal(t, []interface{}{time.Duration(0), false}, reserve(lr))
+	assert.Equal(t, int64(2), counters.Get("ratelimit.backfill.throttled"))
+
+	billing := &Request{Type: "index", Index: Index{Index: "other"}, producer: "billing"}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, []interface{}{time.Duration(0), false}, reserve(billing))
+	}
+
+	assert.Equal(t, []interface{}{100 * time.Millisecond, true}, reserve(billing))
+
+	state := l.state()
+	assert.Equal(t, "backfill", state[0].Name)
+	assert.Equal(t, float64(0), state[0].Tokens)
+	assert.Equal(t, 0, state[0].Deferred)
+	assert.Equal(t, float64(-1), state[1].Tokens)
+	assert.Equal(t, 1, state[1].Deferred)
+}
+
+func TestRateLimiter_Defer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l, err := newRateLimiter([]RateLimitConfig{{Name: "backfill", Index: "lr-*", Rate: 20, Burst: 1}}, NewCounters())
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	// limits match resolved index names.
+	rename := func(next Writer) Writer {
+		return func(req *Request) error {
+			if "other" != req.Index.Index {
+				req.Index.Index = "lr-" + req.Index.Index
+			}
+
+			return next(req)
+		}
+	}
+
+	written := make(chan string, 10)
+	writer := Chain(rename, l.wrap)(func(req *Request) error {
+		written <- req.Index.Id
+
+		return nil
+	})
+
+	queue := &memoryQueue{ch: make(chan string, 10)}
+	assert.NoError(t, (&listener{throttling: true}).Run(ctx, make(chan error, 10), queue, writer))
+	_ = queue.Write(
+		`{"type": "index", "index": {"index": "1", "id": "a"}}`,
+		`{"type": "index", "index": {"index": "1", "id": "b"}}`,
+		`{"type": "index", "index": {"index": "other", "id": "x"}}`,
+		`{"type": "index", "index": {"index": "1", "id": "c"}}`,
+	)
+
+	ids := []string{}
+	for len(ids) < 4 {
+		select {
+		case id := <-written:
+			ids = append(ids, id)
+
+		case <-time.After(time.Second):
+			t.Error("deferred requests are not written")
+			t.FailNow()
+		}
+	}
+
+	// throttled requests do not hold other requests, & keep their order.
+	assert.Equal(t, []string{"a", "x", "b", "c"}, ids)
+	assert.Equal(t, 0, l.state()[0].Deferred)
+}
@@ -0,0 +1,178 @@
+package redes_writer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// value which masked fields are replaced with.
+const redactedValue = "***"
+
+type (
+	// redactor applies redaction policies to documents, upserts and script
+	// params of requests before they are serialized for Elastic Search.
+	redactor struct {
+		policies []redactionPolicy
+		counters *Counters
+	}
+
+	redactionPolicy struct {
+		name   string
+		index  string
+		paths  [][]string
+		action string
+		key    []byte // of hash action
+	}
+)
+
+func newRedactor(configs []RedactionConfig, counters *Counters) (*redactor, error) {
+	r := &redactor{counters: counters}
+	for i, cnf := range configs {
+		if "" == cnf.Name {
+			return nil, fmt.Errorf("redactions[%d]: missing name", i)
+		}
+
+		policy := redactionPolicy{name: cnf.Name, index: cnf.Index, action: cnf.Action, key: []byte(cnf.Key)}
+		switch policy.action {
+		case "":
+			policy.action = "mask"
+
+		case "hash":
+			// unsalted hashes of personal data are reversed with a dictionary.
+			if "" == cnf.Key {
+				return nil, fmt.Errorf("redactions[%d]: missing key of hash action", i)
+			}
+
+		case "mask", "remove":
+
+		default:
+			return nil, fmt.Errorf("redactions[%d]: unknown action %q", i, cnf.Action)
+		}
+
+		for _, path := range cnf.Paths {
+			policy.paths = append(policy.paths, parseJsonPath(path))
+		}
+
+		r.policies = append(r.policies, policy)
+	}
+
+	return r, nil
+}
+
+// wrap returns a writer which redacts requests before writing.
+func (r *redactor) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req {
+			r.apply(req)
+		}
+
+		return writer(req)
+	}
+}
+
+func (r *redactor) apply(req *Request) {
+	roots := []interface{}{}
+	switch req.Type {
+	case "index":
+		roots = append(roots, req.Index.Doc)
+
+	case "update":
+		roots = append(roots, req.Update.Doc, req.Update.Upsert)
+		if nil != req.Update.Script {
+			roots = append(roots, req.Update.Script.Params)
+		}
+	}
+
+	for _, policy := range r.policies {
+		if !matchIndex(policy.index, req.indexName()) {
+			continue
+		}
+
+		count := 0
+		for _, root := range roots {
+			for _, path := range policy.paths {
+				count += redact(root, path, policy.action, policy.key)
+			}
+		}
+
+		if count > 0 {
+			r.counters.Add("redaction."+policy.name, int64(count))
+		}
+	}
+}
+
+// parseJsonPath splits path like $.users[*].email into keys: users, *, email.
+func parseJsonPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	path = strings.Replace(path, "[", ".", -1)
+	path = strings.Replace(path, "]", "", -1)
+
+	return strings.Split(path, ".")
+}
+
+// redact applies action on values at path inside container, returns number of
+// redacted values. Wildcard * matches all items of arrays and objects.
+func redact(container interface{}, path []string, action string, hashKey []byte) int {
+	key, last := path[0], 1 == len(path)
+	count := 0
+
+	switch c := container.(type) {
+	case map[string]interface{}:
+		for k, v := range c {
+			if "*" != key && k != key {
+				continue
+			}
+
+			if !last {
+				count += redact(v, path[1:], action, hashKey)
+				continue
+			}
+
+			if "remove" == action {
+				delete(c, k)
+			} else {
+				c[k] = redactValue(v, action, hashKey)
+			}
+
+			count++
+		}
+
+	case []interface{}:
+		for i, v := range c {
+			if "*" != key && strconv.Itoa(i) != key {
+				continue
+			}
+
+			if !last {
+				count += redact(v, path[1:], action, hashKey)
+				continue
+			}
+
+			// items can't be removed without changing the array, set them to null.
+			if "remove" == action {
+				c[i] = nil
+			} else {
+				c[i] = redactValue(v, action, hashKey)
+			}
+
+			count++
+		}
+	}
+
+	return count
+}
+
+func redactValue(value interface{}, action string, hashKey []byte) interface{} {
+	if "hash" == action {
+		mac := hmac.New(sha256.New, hashKey)
+		_, _ = mac.Write([]byte(fmt.Sprint(value)))
+
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+
+	return redactedValue
+}
@@ -0,0 +1,53 @@
+package redes_writer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactor(t *testing.T) {
+	counters := NewCounters()
+	r, err := newRedactor([]RedactionConfig{
+		{Name: "email", Index: "audit-*", Paths: []string{"$.user.email", "$.email"}},
+		{Name: "phone", Paths: []string{"$.user.phones[*]"}, Action: "remove"},
+		{Name: "national_id", Paths: []string{"national_id"}, Action: "hash", Key: "secret"},
+	}, counters)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	req, _ := fromBytes(`{"type": "update", "update": {
+		"index": "audit-2026",
+		"id": "1",
+		"doc": {"user": {"email": "a@b.c", "name": "A", "phones": ["123", "456"]}},
+		"upsert": {"national_id": "a"},
+		"script": {"source": "ctx._source.email = params.email", "params": {"email": "a@b.c"}}
+	}}`)
+
+	r.apply(req)
+
+	assert.Equal(t, map[string]interface{}{
+		"user": map[string]interface{}{"email": "***", "name": "A", "phones": []interface{}{nil, nil}},
+	}, req.Update.Doc)
+
+	assert.Equal(t, map[string]interface{}{"national_id": "4048c44911916043ff626895ff78c5262764685b6cb9a03ce07886a9effb924c"}, req.Update.Upsert)
+	assert.Equal(t, "***", req.Update.Script.Params["email"])
+
+	assert.Equal(t, int64(2), counters.Get("redaction.email"))
+	assert.Equal(t, int64(2), counters.Get("redaction.phone"))
+	assert.Equal(t, int64(1), counters.Get("redaction.national_id"))
+
+	// policy is not applied for other indices
+	req, _ = fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"email": "a@b.c"}}}`)
+	r.apply(req)
+	assert.Equal(t, map[string]interface{}{"email": "a@b.c"}, req.Index.Doc)
+
+	_, err = newRedactor([]RedactionConfig{{Name: "x", Action: "encrypt"}}, counters)
+	assert.Error(t, err)
+
+	_, err = newRedactor([]RedactionConfig{{Name: "x", Action: "hash"}}, counters)
+	assert.EqualError(t, err, "redactions[0]: missing key of hash action")
+}
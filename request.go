@@ -14,6 +14,45 @@ type (
 		Index  Index  `json:"index"`
 		Update Update `json:"update"`
 		Delete Delete `json:"delete"`
+
+		// index administration, executed outside of bulk requests, after
+		// flushing the requests written before them.
+		CreateIndex CreateIndex `json:"create_index"`
+		PutAlias    PutAlias    `json:"put_alias"`
+		SwapAlias   SwapAlias   `json:"swap_alias"`
+		Refresh     Refresh     `json:"refresh"`
+		DeleteIndex DeleteIndex `json:"delete_index"`
+
+		// address many documents by query, executed as Elastic Search tasks.
+		UpdateByQuery ByQuery `json:"update_by_query"`
+		DeleteByQuery ByQuery `json:"delete_by_query"`
+
+		// optional, producer can safely retry writing a request with same key,
+		// the request is only applied once within the configured TTL.
+		IdempotencyKey string `json:"idempotency_key,omitempty"`
+
+		// name of Elastic Search cluster to write to, decided by routes.
+		cluster string
+
+		// identity of producer, when request is wrapped in signed envelope.
+		producer  string
+		signature string
+		payload   []byte // signed bytes of request
+
+		// idempotency keys remembered for the request, forgotten when writing
+		// it fails, so that producer can retry.
+		idempotencyKeys []string
+
+		// request was deferred by rate limits, its tokens are already taken.
+		throttled bool
+	}
+
+	// envelope of request signed by producer:
+	// {"producer": "billing", "signature": "hex(hmac-sha256(key, request))", "request": {...}}
+	envelope struct {
+		Producer  string          `json:"producer"`
+		Signature string          `json:"signature"`
+		Request   json.RawMessage `json:"request"`
 	}
 
 	Index struct {
@@ -30,20 +69,30 @@ type (
 	}
 
 	Update struct {
-		Index           string          `json:"index"`
-		Type            string          `json:"type"`
-		Id              string          `json:"id"`
-		Parent          string          `json:"parent"`
-		Routing         string          `json:"routing"`
-		Version         *int64          `json:"version,omitEmpty"` // default is MATCH_ANY
-		VersionType     *string         `json:"version_type"`      // default is "internal"
-		DetectNoop      *bool           `json:"detect_noop"`
-		Doc             interface{}     `json:"doc"`
-		DocAsUpsert     *bool           `json:"doc_as_upsert"`
-		Upsert          interface{}     `json:"upsert"`
-		Script          *elastic.Script `json:"script"`
-		RetryOnConflict *int            `json:"retry_on_conflict"`
-		ScriptedUpsert  bool            `json:"scripted_upsert"`
+		Index           string      `json:"index"`
+		Type            string      `json:"type"`
+		Id              string      `json:"id"`
+		Parent          string      `json:"parent"`
+		Routing         string      `json:"routing"`
+		Version         *int64      `json:"version,omitEmpty"` // default is MATCH_ANY
+		VersionType     *string     `json:"version_type"`      // default is "internal"
+		DetectNoop      *bool       `json:"detect_noop"`
+		Doc             interface{} `json:"doc"`
+		DocAsUpsert     *bool       `json:"doc_as_upsert"`
+		Upsert          interface{} `json:"upsert"`
+		Script          *Script     `json:"script"`
+		RetryOnConflict *int        `json:"retry_on_conflict"`
+		ScriptedUpsert  bool        `json:"scripted_upsert"`
+	}
+
+	// script of update request, same as "script" object in Elastic Search's
+	// update API. Short form of inline script, "script": "ctx._source.counter++",
+	// is also accepted.
+	Script struct {
+		Source string                 `json:"source,omitempty"`
+		Id     string                 `json:"id,omitempty"` // stored script
+		Lang   string                 `json:"lang,omitempty"`
+		Params map[string]interface{} `json:"params,omitempty"`
 	}
 
 	Delete struct {
@@ -55,6 +104,40 @@ type (
 		Version     *int64  `json:"version,omitEmpty"` // default is MATCH_ANY
 		VersionType *string `json:"version_type"`      // default is "internal"
 	}
+
+	CreateIndex struct {
+		Index string      `json:"index"`
+		Body  interface{} `json:"body"` // settings, mappings & aliases
+	}
+
+	PutAlias struct {
+		Index string `json:"index"`
+		Alias string `json:"alias"`
+	}
+
+	// move alias from one index to another atomically, e.g. after reindexing.
+	SwapAlias struct {
+		Alias string `json:"alias"`
+		From  string `json:"from"`
+		To    string `json:"to"`
+	}
+
+	Refresh struct {
+		Index string `json:"index"`
+	}
+
+	DeleteIndex struct {
+		Index string `json:"index"`
+	}
+
+	ByQuery struct {
+		Index     string      `json:"index"`     // comma separated, wildcard is supported
+		Query     interface{} `json:"query"`     // e.g. {"term": {"tenant": "x"}}
+		Script    *Script     `json:"script"`    // update_by_query only
+		Conflicts string      `json:"conflicts"` // abort (default) or proceed
+		Slices    interface{} `json:"slices"`    // number of slices or "auto"
+		Routing   string      `json:"routing"`
+	}
 )
 
 func (r Request) String() string {
@@ -80,9 +163,106 @@ func (r Request) Source() ([]string, error) {
 	return nil, fmt.Errorf("invalid request type")
 }
 
+// key identifies the document which the request is addressing.
+// Requests without document ID (auto generated by ES) have empty key.
+func (r Request) key() string {
+	var index, typ, id, routing string
+
+	switch r.Type {
+	case "index":
+		index, typ, id, routing = r.Index.Index, r.Index.Type, r.Index.Id, r.Index.Routing
+
+	case "update":
+		index, typ, id, routing = r.Update.Index, r.Update.Type, r.Update.Id, r.Update.Routing
+
+	case "delete":
+		index, typ, id, routing = r.Delete.Index, r.Delete.Type, r.Delete.Id, r.Delete.Routing
+	}
+
+	if "" == id {
+		return ""
+	}
+
+	return strings.Join([]string{index, typ, id, routing}, "/")
+}
+
+// id returns ID of the document which the request is addressing.
+func (r Request) id() string {
+	switch r.Type {
+	case "index":
+		return r.Index.Id
+
+	case "update":
+		return r.Update.Id
+
+	case "delete":
+		return r.Delete.Id
+	}
+
+	return ""
+}
+
+// indexName returns name of the index which the request is addressing.
+func (r Request) indexName() string {
+	switch r.Type {
+	case "index":
+		return r.Index.Index
+
+	case "update":
+		return r.Update.Index
+
+	case "delete":
+		return r.Delete.Index
+	}
+
+	return ""
+}
+
+func (r *Request) setIndexName(name string) {
+	switch r.Type {
+	case "index":
+		r.Index.Index = name
+
+	case "update":
+		r.Update.Index = name
+
+	case "delete":
+		r.Delete.Index = name
+	}
+}
+
+// doc returns the document carried by the request, nil for delete requests.
+func (r Request) doc() interface{} {
+	switch r.Type {
+	case "index":
+		return r.Index.Doc
+
+	case "update":
+		if nil != r.Update.Doc {
+			return r.Update.Doc
+		}
+
+		return r.Update.Upsert
+	}
+
+	return nil
+}
+
 func fromBytes(raw string) (*Request, error) {
+	env := envelope{}
+	err := json.Unmarshal([]byte(raw), &env)
+	if nil != err {
+		return nil, err
+	}
+
 	req := &Request{}
-	err := json.Unmarshal([]byte(raw), &req)
+	if len(env.Request) > 0 {
+		err = json.Unmarshal(env.Request, &req)
+		req.producer, req.signature, req.payload = env.Producer, env.Signature, env.Request
+	} else {
+		err = json.Unmarshal([]byte(raw), &req)
+	}
+
 	if nil != err {
 		return nil, err
 	}
@@ -140,7 +320,7 @@ func toBulkUpdate(w Request) *elastic.BulkUpdateRequest {
 	b.Upsert(req.Upsert)
 
 	if req.Script != nil {
-		b.Script(req.Script)
+		b.Script(req.Script.toElastic())
 		b.ScriptedUpsert(req.ScriptedUpsert)
 	}
 
@@ -151,6 +331,39 @@ func toBulkUpdate(w Request) *elastic.BulkUpdateRequest {
 	return b
 }
 
+func (s *Script) UnmarshalJSON(data []byte) error {
+	var source string
+	if err := json.Unmarshal(data, &source); nil == err {
+		*s = Script{Source: source}
+
+		return nil
+	}
+
+	// alias type to not call this method recursively
+	type script Script
+
+	return json.Unmarshal(data, (*script)(s))
+}
+
+func (s *Script) toElastic() *elastic.Script {
+	var script *elastic.Script
+	if "" != s.Id {
+		script = elastic.NewScriptStored(s.Id)
+	} else {
+		script = elastic.NewScriptInline(s.Source)
+	}
+
+	if "" != s.Lang {
+		script.Lang(s.Lang)
+	}
+
+	if len(s.Params) > 0 {
+		script.Params(s.Params)
+	}
+
+	return script
+}
+
 func toBulkDelete(w Request) *elastic.BulkDeleteRequest {
 	req := &w.Delete
 
@@ -0,0 +1,133 @@
+package redes_writer
+
+import (
+	"fmt"
+	"path"
+)
+
+// name of the cluster configured by elasticsearch.url
+const defaultCluster = "default"
+
+// router rewrites requests by the routes section in configuration, before they
+// are converted into bulk requests. Routes are evaluated in order, first match wins.
+//
+// Routes matching a field of the document can't be resolved for deletes and
+// updates which don't carry the field, they're written to the source index,
+// unless the route rejects them: producer must address the routed index.
+type router struct {
+	routes []RouteConfig
+}
+
+func newRouter(routes []RouteConfig, clusters []string) (*router, error) {
+	for i, route := range routes {
+		if "" != route.Match.Index {
+			if _, err := path.Match(route.Match.Index, ""); nil != err {
+				return nil, fmt.Errorf("routes[%d]: invalid index pattern %q", i, route.Match.Index)
+			}
+		}
+
+		if "" != route.Match.Field && "delete" == route.Match.Type {
+			return nil, fmt.Errorf("routes[%d]: delete requests have no document to match field %q", i, route.Match.Field)
+		}
+
+		if "" != route.Cluster && !contains(clusters, route.Cluster) {
+			return nil, fmt.Errorf("routes[%d]: unknown cluster %q", i, route.Cluster)
+		}
+	}
+
+	return &router{routes: routes}, nil
+}
+
+// wrap returns a writer which applies matching route before writing.
+func (r *router) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req {
+			if err := r.apply(req); nil != err {
+				return reject(err)
+			}
+		}
+
+		return writer(req)
+	}
+}
+
+func (r *router) apply(req *Request) error {
+	for i, route := range r.routes {
+		if route.RejectUnresolved && !route.resolvable(req) {
+			return fmt.Errorf("routes[%d]: %s request to %s/%s has no field %s to be routed by", i, req.Type, req.indexName(), req.id(), route.Match.Field)
+		}
+
+		if !route.matches(req) {
+			continue
+		}
+
+		if "" != route.Cluster {
+			req.cluster = route.Cluster
+		}
+
+		if "" != route.Index {
+			req.setIndexName(route.Index)
+		}
+
+		// only index requests can be sent through ingest pipeline.
+		if "" != route.Pipeline && "index" == req.Type {
+			req.Index.Pipeline = route.Pipeline
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// resolvable tells whether it can be decided if the route matches request:
+// deletes and updates without the matched field may address documents which
+// were routed by it.
+func (route RouteConfig) resolvable(req *Request) bool {
+	m := route.Match
+	if "" == m.Field || ("delete" != req.Type && "update" != req.Type) {
+		return true
+	}
+
+	if ("" != m.Type && m.Type != req.Type) || !matchIndex(m.Index, req.indexName()) {
+		return true
+	}
+
+	_, ok := getField(req.doc(), m.Field)
+
+	return ok
+}
+
+func (route RouteConfig) matches(req *Request) bool {
+	return route.Match.matches(req)
+}
+
+func (m MatchConfig) matches(req *Request) bool {
+	if "" != m.Type && m.Type != req.Type {
+		return false
+	}
+
+	if !matchIndex(m.Index, req.indexName()) {
+		return false
+	}
+
+	if "" != m.Field {
+		value, ok := getField(req.doc(), m.Field)
+		if !ok || fmt.Sprint(value) != m.Value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchIndex checks index name against glob pattern, empty pattern matches all.
+func matchIndex(pattern string, index string) bool {
+	if "" == pattern {
+		return true
+	}
+
+	matched, _ := path.Match(pattern, index)
+
+	return matched
+}
@@ -0,0 +1,104 @@
+package redes_writer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRouter(t *testing.T) {
+	var cnf Config
+	err := yaml.Unmarshal([]byte(`
+routes:
+  - match: { index: "lr", type: "index", field: "tenant.name", value: "acme" }
+    index: "lr-acme"
+    pipeline: "acme"
+  - match: { index: "lr*" }
+    cluster: "default"
+    index: "lr-v2"
+`), &cnf)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	r, err := newRouter(cnf.Routes, []string{"default"})
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	i1, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"tenant": {"name": "acme"}}}}`)
+	r.apply(i1)
+	assert.Equal(t, "lr-acme", i1.Index.Index)
+	assert.Equal(t, "acme", i1.Index.Pipeline)
+	assert.Equal(t, "", i1.cluster)
+
+	i2, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "2", "doc": {"tenant": {"name": "other"}}}}`)
+	r.apply(i2)
+	assert.Equal(t, "lr-v2", i2.Index.Index)
+	assert.Equal(t, "", i2.Index.Pipeline)
+	assert.Equal(t, "default", i2.cluster)
+
+	d1, _ := fromBytes(`{"type": "delete", "delete": {"index": "audit", "id": "3"}}`)
+	assert.NoError(t, r.apply(d1))
+	assert.Equal(t, "audit", d1.Delete.Index)
+
+	u1, _ := fromBytes(`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"tenant": {"name": "acme"}, "title": "x"}}}`)
+	assert.NoError(t, r.apply(u1))
+	assert.Equal(t, "lr-v2", u1.Update.Index, "field route only matches index requests")
+
+	_, err = newRouter([]RouteConfig{{Cluster: "unknown"}}, []string{"default"})
+	assert.Error(t, err)
+
+	_, err = newRouter([]RouteConfig{{Match: MatchConfig{Type: "delete", Field: "tenant", Value: "acme"}}}, []string{"default"})
+	assert.Error(t, err)
+}
+
+func TestRouter_UnresolvableField(t *testing.T) {
+	route := RouteConfig{Match: MatchConfig{Index: "lr", Field: "tenant", Value: "acme"}, Index: "lr-acme"}
+	cases := map[string]string{
+		`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"tenant": "acme"}}}`:                                 "lr-acme",
+		`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"title": "no tenant"}}}`:                             "lr",
+		`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"tenant": "acme", "title": "x"}}}`:                 "lr-acme",
+		`{"type": "update", "update": {"index": "lr", "id": "1", "upsert": {"tenant": "acme"}, "script": {"source": "x"}}}`: "lr-acme",
+		`{"type": "delete", "delete": {"index": "lr-acme", "id": "1"}}`:                                                     "lr-acme",
+		`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`:                                                          "",
+		`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"title": "x"}}}`:                                   "",
+	}
+
+	for _, reject := range []bool{false, true} {
+		route.RejectUnresolved = reject
+		r, err := newRouter([]RouteConfig{route}, []string{"default"})
+		if nil != err {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		for raw, index := range cases {
+			written := ""
+			req, _ := fromBytes(raw)
+			err := r.wrap(func(req *Request) error {
+				written = req.indexName()
+
+				return nil
+			})(req)
+
+			switch {
+			case "" != index:
+				assert.NoError(t, err, raw)
+				assert.Equal(t, index, written, raw)
+
+			case reject:
+				assert.IsType(t, &ValidationError{}, err, raw)
+
+			default:
+				// documents of tenants which are not routed stay in source index.
+				assert.NoError(t, err, raw)
+				assert.Equal(t, "lr", written, raw)
+			}
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package redes_writer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+type (
+	// schemaValidator validates documents against JSON schemas registered per
+	// index pattern. Non-conforming requests are rejected, not written.
+	//
+	// Supported keywords: type, enum, const, required, properties,
+	// additionalProperties, items, minimum, maximum, minLength, maxLength,
+	// pattern, minItems, maxItems. Schemas with other keywords are invalid.
+	schemaValidator struct {
+		rules    []schemaRule
+		counters *Counters
+	}
+
+	schemaRule struct {
+		index  string
+		schema map[string]interface{}
+	}
+)
+
+// keywords which schemas may use, others are rejected when schemas are loaded
+// instead of being silently ignored.
+var schemaKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true, "required": true, "properties": true,
+	"additionalProperties": true, "items": true, "minimum": true, "maximum": true,
+	"minLength": true, "maxLength": true, "pattern": true, "minItems": true, "maxItems": true,
+
+	// annotations, no effect on validation.
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true,
+}
+
+func newSchemaValidator(configs []SchemaConfig, counters *Counters) (*schemaValidator, error) {
+	v := &schemaValidator{counters: counters}
+	for i, cnf := range configs {
+		var schema interface{}
+		if "" != cnf.File {
+			content, err := ioutil.ReadFile(cnf.File)
+			if nil != err {
+				return nil, fmt.Errorf("schemas[%d]: %s", i, err)
+			}
+
+			if err := json.Unmarshal(content, &schema); nil != err {
+				return nil, fmt.Errorf("schemas[%d]: invalid JSON in %s: %s", i, cnf.File, err)
+			}
+		} else {
+			schema = normalizeYaml(cnf.Schema)
+		}
+
+		object, ok := schema.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("schemas[%d]: schema must be an object", i)
+		}
+
+		compiled, err := compileSchema(object, "$")
+		if nil != err {
+			return nil, fmt.Errorf("schemas[%d]: %s", i, err)
+		}
+
+		v.rules = append(v.rules, schemaRule{index: cnf.Index, schema: compiled})
+	}
+
+	return v, nil
+}
+
+// wrap returns a writer which rejects requests with invalid documents.
+func (v *schemaValidator) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req {
+			if err := v.validate(req); nil != err {
+				v.counters.Add("schema.rejected", 1)
+
+				return reject(err)
+			}
+		}
+
+		return writer(req)
+	}
+}
+
+// validate checks documents of request. Doc of update request is partial,
+// so that required properties are not checked.
+func (v *schemaValidator) validate(req *Request) error {
+	for _, rule := range v.rules {
+		if !matchIndex(rule.index, req.indexName()) {
+			continue
+		}
+
+		var err error
+		switch req.Type {
+		case "index":
+			err = validateSchema(rule.schema, req.Index.Doc, "$", false)
+
+		case "update":
+			if nil != req.Update.Doc {
+				err = validateSchema(rule.schema, req.Update.Doc, "$", true)
+			}
+
+			if nil == err && nil != req.Update.Upsert {
+				err = validateSchema(rule.schema, req.Update.Upsert, "$", false)
+			}
+		}
+
+		if nil != err {
+			return fmt.Errorf("document for %s violates schema: %s", req.indexName(), err)
+		}
+	}
+
+	return nil
+}
+
+// compileSchema checks keywords of schema & its sub-schemas, returns a copy
+// of schema where patterns are compiled regular expressions.
+func compileSchema(schema map[string]interface{}, path string) (map[string]interface{}, error) {
+	compiled := make(map[string]interface{}, len(schema))
+	for keyword, value := range schema {
+		if !schemaKeywords[keyword] {
+			return nil, fmt.Errorf("%s: unsupported keyword %s", path, keyword)
+		}
+
+		var err error
+		compiled[keyword] = value
+		switch keyword {
+		case "pattern":
+			pattern, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: pattern must be a string", path)
+			}
+
+			if compiled[keyword], err = regexp.Compile(pattern); nil != err {
+				return nil, fmt.Errorf("%s: invalid pattern %q: %s", path, pattern, err)
+			}
+
+		case "properties":
+			properties, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: properties must be an object", path)
+			}
+
+			compiledProperties := make(map[string]interface{}, len(properties))
+			for name, property := range properties {
+				sub, ok := property.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s.%s: schema must be an object", path, name)
+				}
+
+				if compiledProperties[name], err = compileSchema(sub, path+"."+name); nil != err {
+					return nil, err
+				}
+			}
+
+			compiled[keyword] = compiledProperties
+
+		case "items":
+			sub, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s: items must be a schema object", path)
+			}
+
+			if compiled[keyword], err = compileSchema(sub, path+"[]"); nil != err {
+				return nil, err
+			}
+
+		case "additionalProperties":
+			switch sub := value.(type) {
+			case bool:
+			case map[string]interface{}:
+				if compiled[keyword], err = compileSchema(sub, path+".*"); nil != err {
+					return nil, err
+				}
+
+			default:
+				return nil, fmt.Errorf("%s: additionalProperties must be a boolean or a schema object", path)
+			}
+		}
+	}
+
+	return compiled, nil
+}
+
+func validateSchema(schema map[string]interface{}, value interface{}, path string, partial bool) error {
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		return fmt.Errorf("%s: expected %v, got %s", path, types, jsonType(value))
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if jsonEqual(item, value) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return fmt.Errorf("%s: must be one of %v", path, enum)
+		}
+	}
+
+	if expected, ok := schema["const"]; ok && !jsonEqual(expected, value) {
+		return fmt.Errorf("%s: must be %v", path, expected)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schema, v, path, partial)
+
+	case []interface{}:
+		if min, ok := toFloat(schema["minItems"]); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: must have at least %v items", path, min)
+		}
+
+		if max, ok := toFloat(schema["maxItems"]); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: must have at most %v items", path, max)
+		}
+
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i), partial); nil != err {
+					return err
+				}
+			}
+		}
+
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := toFloat(schema["minLength"]); ok && length < min {
+			return fmt.Errorf("%s: must have at least %v characters", path, min)
+		}
+
+		if max, ok := toFloat(schema["maxLength"]); ok && length > max {
+			return fmt.Errorf("%s: must have at most %v characters", path, max)
+		}
+
+		if re, ok := schema["pattern"].(*regexp.Regexp); ok && !re.MatchString(v) {
+			return fmt.Errorf("%s: must match %q", path, re.String())
+		}
+
+	case float64:
+		if min, ok := toFloat(schema["minimum"]); ok && v < min {
+			return fmt.Errorf("%s: must be >= %v", path, min)
+		}
+
+		if max, ok := toFloat(schema["maximum"]); ok && v > max {
+			return fmt.Errorf("%s: must be <= %v", path, max)
+		}
+	}
+
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, object map[string]interface{}, path string, partial bool) error {
+	if required, ok := schema["required"].([]interface{}); ok && !partial {
+		for _, name := range required {
+			if _, ok := object[fmt.Sprint(name)]; !ok {
+				return fmt.Errorf("%s: missing required property %v", path, name)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	// sorted, so that same document always reports same violation.
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if property, ok := properties[name].(map[string]interface{}); ok {
+			if err := validateSchema(property, object[name], path+"."+name, partial); nil != err {
+				return err
+			}
+
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: additional property %s is not allowed", path, name)
+			}
+
+		case map[string]interface{}:
+			if err := validateSchema(additional, object[name], path+"."+name, partial); nil != err {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func matchesType(types interface{}, value interface{}) bool {
+	switch t := types.(type) {
+	case string:
+		actual := jsonType(value)
+
+		return t == actual || ("number" == t && "integer" == actual)
+
+	case []interface{}:
+		for _, item := range t {
+			if matchesType(item, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	case float64:
+		if v == float64(int64(v)) {
+			return "integer"
+		}
+
+		return "number"
+	}
+
+	return strings.ToLower(reflect.TypeOf(value).Kind().String())
+}
+
+// jsonEqual compares values from schema (may be decoded from yaml) and document.
+func jsonEqual(a interface{}, b interface{}) bool {
+	if fa, ok := toFloat(a); ok {
+		fb, ok := toFloat(b)
+
+		return ok && fa == fb
+	}
+
+	return reflect.DeepEqual(a, b)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,102 @@
+package redes_writer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	var cnf Config
+	err := yaml.Unmarshal([]byte(`
+schemas:
+  - index: "lr*"
+    schema:
+      type: object
+      required: [user_id, status]
+      additionalProperties: false
+      properties:
+        user_id: { type: integer, minimum: 1 }
+        status: { enum: [active, archived] }
+        email: { type: string, pattern: "@" }
+        tags: { type: array, maxItems: 2, items: { type: string } }
+        score: { type: [number, "null"] }
+`), &cnf)
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	v, err := newSchemaValidator(cnf.Schemas, NewCounters())
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	_, err = newSchemaValidator(cnf.Schemas, NewCounters())
+	assert.NoError(t, err, "config is not changed by compiling patterns")
+
+	cases := map[string]string{
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": 1, "status": "active", "tags": ["a"], "score": null}}}`:  "",
+		`{"type": "index", "index": {"index": "other", "doc": {"anything": true}}}`:                                             "",
+		`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"status": "archived"}}}`:                               "",
+		`{"type": "index", "index": {"index": "lr", "doc": {"status": "active"}}}`:                                              "$: missing required property user_id",
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": "1", "status": "active"}}}`:                              "$.user_id: expected integer, got string",
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": 1.5, "status": "active"}}}`:                              "$.user_id: expected integer, got number",
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": 0, "status": "active"}}}`:                                "$.user_id: must be >= 1",
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": 1, "status": "deleted"}}}`:                               "$.status: must be one of [active archived]",
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": 1, "status": "active", "extra": 1}}}`:                    "$: additional property extra is not allowed",
+		`{"type": "index", "index": {"index": "lr", "doc": {"user_id": 1, "status": "active", "tags": ["a", 1]}}}`:              "$.tags[1]: expected string, got integer",
+		`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"email": "invalid"}}}`:                                 "$.email: must match \"@\"",
+		`{"type": "update", "update": {"index": "lr", "id": "1", "doc": {"status": "active"}, "upsert": {"status": "active"}}}`: "$: missing required property user_id",
+	}
+
+	for raw, expected := range cases {
+		req, _ := fromBytes(raw)
+		err := v.validate(req)
+		if "" == expected {
+			assert.NoError(t, err, raw)
+		} else if assert.Error(t, err, raw) {
+			assert.Contains(t, err.Error(), expected, raw)
+		}
+	}
+}
+
+func TestSchemaValidator_Reject(t *testing.T) {
+	counters := NewCounters()
+	v, _ := newSchemaValidator([]SchemaConfig{{Schema: map[interface{}]interface{}{"type": "object", "required": []interface{}{"id"}}}}, counters)
+	writer := v.wrap(func(req *Request) error { return nil })
+
+	req, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "doc": {}}}`)
+	err := writer(req)
+
+	_, rejected := err.(*ValidationError)
+	assert.True(t, rejected)
+	assert.Equal(t, int64(1), counters.Get("schema.rejected"))
+}
+
+func TestSchemaValidator_InvalidSchema(t *testing.T) {
+	cases := map[string]string{
+		`{"oneOf": [{"type": "string"}]}`:                                            "schemas[0]: $: unsupported keyword oneOf",
+		`{"properties": {"user": {"$ref": "#/definitions/user"}}}`:                   "schemas[0]: $.user: unsupported keyword $ref",
+		`{"items": {"type": "string", "format": "email"}}`:                           "schemas[0]: $[]: unsupported keyword format",
+		`{"properties": {"email": {"pattern": "("}}}`:                                "schemas[0]: $.email: invalid pattern \"(\"",
+		`{"additionalProperties": {"pattern": "["}}`:                                 "schemas[0]: $.*: invalid pattern \"[\"",
+		`{"title": "user", "description": "annotations are fine", "type": "object"}`: "",
+	}
+
+	for schema, expected := range cases {
+		var object interface{}
+		assert.NoError(t, json.Unmarshal([]byte(schema), &object))
+
+		_, err := newSchemaValidator([]SchemaConfig{{Schema: object}}, NewCounters())
+		if "" == expected {
+			assert.NoError(t, err, schema)
+		} else if assert.Error(t, err, schema) {
+			assert.Contains(t, err.Error(), expected, schema)
+		}
+	}
+}
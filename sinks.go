@@ -0,0 +1,334 @@
+package redes_writer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultSinkMaxBytes = 100 << 20
+	defaultSinkMaxFiles = 5
+	defaultSinkTimeout  = 10 * time.Second
+
+	// requests waiting to be posted by webhook sink.
+	defaultWebhookBuffer = 1000
+)
+
+type (
+	// fileSink appends requests to a NDJSON file, one request JSON per line,
+	// so that archived requests can be pushed back to the queue. The file is
+	// rotated when it's larger than maxBytes: path.1 is the newest rotated file.
+	fileSink struct {
+		mu       sync.Mutex
+		path     string
+		maxBytes int64
+		maxFiles int
+		file     *os.File
+		size     int64
+	}
+
+	// stdoutSink prints requests, for dry runs with listener.dryRun.
+	stdoutSink struct {
+		mu  sync.Mutex
+		out io.Writer
+	}
+
+	// webhookSink posts each request as JSON to an HTTP endpoint, in its own
+	// goroutine: listener doesn't wait for the endpoint. Writing fails when
+	// the buffer of requests waiting to be posted is full.
+	webhookSink struct {
+		mu      sync.RWMutex
+		url     string
+		headers map[string]string
+		client  *http.Client
+		closed  bool
+		pending chan []byte
+		done    chan struct{}
+	}
+)
+
+func newSink(cnf SinkConfig) (Sink, error) {
+	switch cnf.Type {
+	case "file":
+		return newFileSink(cnf)
+
+	case "stdout":
+		return &stdoutSink{out: os.Stdout}, nil
+
+	case "webhook":
+		if "" == cnf.Url {
+			return nil, fmt.Errorf("missing url of webhook sink")
+		}
+
+		return newWebhookSink(cnf), nil
+	}
+
+	return nil, fmt.Errorf("unknown sink type %q", cnf.Type)
+}
+
+// newSinkWriter returns a writer to all sinks, counting writes per sink.
+func newSinkWriter(sinks []Sink, names []string, counters *Counters) Writer {
+	return func(req *Request) error {
+		if nil == req {
+			return nil
+		}
+
+		failures := []string{}
+		for i, sink := range sinks {
+			if err := sink.Write(req); nil != err {
+				counters.Add("sink."+names[i]+".failed", 1)
+				failures = append(failures, fmt.Sprintf("sink %s: %s", names[i], err))
+			} else {
+				counters.Add("sink."+names[i]+".written", 1)
+			}
+		}
+
+		if len(failures) > 0 {
+			return fmt.Errorf("%s", strings.Join(failures, "; "))
+		}
+
+		return nil
+	}
+}
+
+// fanOut returns a writer which writes to all writers, failure of one writer
+// doesn't stop the others. Errors are joined by joinErrors, so that request is
+// still retried or rejected.
+func fanOut(writers ...Writer) Writer {
+	if 1 == len(writers) {
+		return writers[0]
+	}
+
+	return func(req *Request) error {
+		errs := []error{}
+		for _, writer := range writers {
+			if err := writer(req); nil != err {
+				errs = append(errs, err)
+			}
+		}
+
+		return joinErrors(errs)
+	}
+}
+
+func newFileSink(cnf SinkConfig) (*fileSink, error) {
+	if "" == cnf.Path {
+		return nil, fmt.Errorf("missing path of file sink")
+	}
+
+	s := &fileSink{path: cnf.Path, maxBytes: cnf.MaxBytes, maxFiles: cnf.MaxFiles}
+	if s.maxBytes <= 0 {
+		s.maxBytes = defaultSinkMaxBytes
+	}
+
+	if s.maxFiles <= 0 {
+		s.maxFiles = defaultSinkMaxFiles
+	}
+
+	return s, s.open()
+}
+
+func (s *fileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if nil != err {
+		return err
+	}
+
+	info, err := file.Stat()
+	if nil != err {
+		_ = file.Close()
+
+		return err
+	}
+
+	s.file, s.size = file, info.Size()
+
+	return nil
+}
+
+func (s *fileSink) Write(req *Request) error {
+	line, err := json.Marshal(req)
+	if nil != err {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if nil == s.file {
+		return fmt.Errorf("file sink %s is closed", s.path)
+	}
+
+	if s.size > 0 && s.size+int64(len(line))+1 > s.maxBytes {
+		if err := s.rotate(); nil != err {
+			return err
+		}
+	}
+
+	n, err := s.file.Write(append(line, '\n'))
+	s.size += int64(n)
+
+	return err
+}
+
+// rotate renames path.N-1 to path.N, ..., path to path.1 then opens new file.
+func (s *fileSink) rotate() error {
+	if err := s.file.Close(); nil != err {
+		return err
+	}
+
+	s.file = nil
+	for i := s.maxFiles - 1; i > 0; i-- {
+		_ = os.Rename(fmt.Sprintf("%s.%d", s.path, i), fmt.Sprintf("%s.%d", s.path, i+1))
+	}
+
+	if err := os.Rename(s.path, s.path+".1"); nil != err {
+		return err
+	}
+
+	return s.open()
+}
+
+func (s *fileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if nil == s.file {
+		return nil
+	}
+
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
+
+func (s *stdoutSink) Write(req *Request) error {
+	output := req.String()
+	if req.isAdmin() || req.isByQuery() {
+		raw, err := json.Marshal(req)
+		if nil != err {
+			return err
+		}
+
+		output = string(raw)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := fmt.Fprintln(s.out, output)
+
+	return err
+}
+
+func (s *stdoutSink) Close() error {
+	return nil
+}
+
+func newWebhookSink(cnf SinkConfig) *webhookSink {
+	timeout := cnf.Timeout
+	if 0 == timeout {
+		timeout = defaultSinkTimeout
+	}
+
+	buffer := cnf.Buffer
+	if buffer <= 0 {
+		buffer = defaultWebhookBuffer
+	}
+
+	s := &webhookSink{
+		url:     cnf.Url,
+		headers: cnf.Headers,
+		client:  &http.Client{Timeout: timeout},
+		pending: make(chan []byte, buffer),
+		done:    make(chan struct{}),
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Write buffers request to be posted, without waiting for the endpoint.
+func (s *webhookSink) Write(req *Request) error {
+	body, err := json.Marshal(req)
+	if nil != err {
+		return err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return fmt.Errorf("webhook %s is closed", s.url)
+	}
+
+	select {
+	case s.pending <- body:
+		return nil
+
+	default:
+		return fmt.Errorf("webhook %s: buffer is full", s.url)
+	}
+}
+
+func (s *webhookSink) run() {
+	defer close(s.done)
+
+	for body := range s.pending {
+		if err := s.post(body); nil != err {
+			logrus.WithError(err).WithField("url", s.url).Errorln("failed to post request to webhook")
+		}
+	}
+}
+
+func (s *webhookSink) post(body []byte) error {
+	httpReq, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if nil != err {
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/json")
+	for name, value := range s.headers {
+		httpReq.Header.Set(name, value)
+	}
+
+	res, err := s.client.Do(httpReq)
+	if nil != err {
+		return err
+	}
+
+	defer res.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded %s", s.url, res.Status)
+	}
+
+	return nil
+}
+
+// Close waits for buffered requests to be posted.
+func (s *webhookSink) Close() error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.pending)
+	}
+	s.mu.Unlock()
+
+	<-s.done
+
+	return nil
+}
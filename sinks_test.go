@@ -0,0 +1,154 @@
+package redes_writer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "es-writer-sink")
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	defer os.RemoveAll(dir)
+
+	sink, err := NewSink(SinkConfig{Type: "file", Path: dir + "/requests.ndjson", MaxBytes: 1500, MaxFiles: 2})
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	for i := 1; i <= 4; i++ {
+		req, _ := fromBytes(fmt.Sprintf(`{"type": "index", "index": {"index": "lr", "id": "%d", "doc": {}}}`, i))
+		assert.NoError(t, sink.Write(req))
+	}
+
+	assert.NoError(t, sink.Close())
+
+	// one request per file, oldest file is dropped.
+	ids := []string{}
+	for _, name := range []string{"requests.ndjson.2", "requests.ndjson.1", "requests.ndjson"} {
+		content, err := ioutil.ReadFile(dir + "/" + name)
+		assert.NoError(t, err)
+
+		lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+		assert.Len(t, lines, 1)
+
+		req, err := fromBytes(lines[0])
+		assert.NoError(t, err)
+		ids = append(ids, req.Index.Id)
+	}
+
+	assert.Equal(t, []string{"2", "3", "4"}, ids)
+
+	_, err = os.Stat(dir + "/requests.ndjson.3")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStdoutSink(t *testing.T) {
+	out := &bytes.Buffer{}
+	sink := &stdoutSink{out: out}
+
+	req, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`)
+	assert.NoError(t, sink.Write(req))
+	assert.Equal(t, req.String()+"\n", out.String())
+}
+
+func TestWebhookSink(t *testing.T) {
+	mu := sync.Mutex{}
+	received := []*Request{}
+	posting := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Token"))
+
+		req := &Request{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(req))
+
+		mu.Lock()
+		received = append(received, req)
+		mu.Unlock()
+
+		if "slow" == req.Delete.Id {
+			posting <- struct{}{}
+			<-release
+		}
+
+		if "fail" == req.Delete.Id {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+
+	defer server.Close()
+
+	sink, err := NewSink(SinkConfig{Type: "webhook", Url: server.URL, Headers: map[string]string{"X-Token": "secret"}, Buffer: 1})
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	counters := NewCounters()
+	writer := newSinkWriter([]Sink{sink}, []string{"audit"}, counters)
+
+	slow, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "slow"}}`)
+	fail, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "fail"}}`)
+	full, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "full"}}`)
+
+	// writing doesn't wait for the endpoint, failed posts are logged.
+	assert.NoError(t, writer(slow))
+	<-posting
+	assert.NoError(t, writer(fail))
+	assert.EqualError(t, writer(full), fmt.Sprintf("sink audit: webhook %s: buffer is full", server.URL))
+
+	close(release)
+	assert.NoError(t, sink.Close())
+	assert.Error(t, writer(full), "webhook is closed")
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "slow", received[0].Delete.Id)
+	assert.Equal(t, "fail", received[1].Delete.Id)
+	assert.Equal(t, int64(2), counters.Get("sink.audit.written"))
+	assert.Equal(t, int64(2), counters.Get("sink.audit.failed"))
+}
+
+func TestFanOut(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// closed cluster & a sink: request is requeued, not dropped.
+	c := &Cluster{Name: "es7", Default: true, ctx: ctx, pending: make(chan *Request, 1), counters: NewCounters(), closed: true}
+	out := &bytes.Buffer{}
+	sink := newSinkWriter([]Sink{&stdoutSink{out: out}}, []string{"stdout"}, NewCounters())
+	req, _ := fromBytes(`{"type": "delete", "delete": {"index": "lr", "id": "1"}}`)
+
+	err := fanOut(Clusters{c}.write, sink)(req)
+	assert.IsType(t, &RetryError{}, err)
+	assert.NotEmpty(t, out.String(), "sink is still written")
+
+	failing := func(req *Request) error { return fmt.Errorf("sink is broken") }
+	assert.IsType(t, &RetryError{}, fanOut(Clusters{c}.write, failing)(req))
+	assert.IsType(t, &ValidationError{}, fanOut(func(req *Request) error { return reject(fmt.Errorf("invalid")) }, failing)(req))
+	assert.EqualError(t, fanOut(failing, failing)(req), "sink is broken; sink is broken")
+	assert.NoError(t, fanOut(sink, sink)(req))
+}
+
+func TestNewSink_Invalid(t *testing.T) {
+	_, err := NewSink(SinkConfig{Type: "kafka"})
+	assert.EqualError(t, err, `unknown sink type "kafka"`)
+
+	_, err = NewSink(SinkConfig{Type: "webhook"})
+	assert.EqualError(t, err, "missing url of webhook sink")
+}
@@ -0,0 +1,136 @@
+package redes_writer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// default maximum size of a spool file.
+const defaultSpoolMaxBytes = 100 << 20
+
+// spool keeps requests on local disk while cluster is unavailable, as
+// newline-delimited JSON, so that they are replayed in order later.
+type spool struct {
+	mu       sync.Mutex
+	path     string
+	maxBytes int64
+	size     int64
+	count    int
+}
+
+// newSpool opens spool file of cluster in dir, requests left by previous run
+// are kept for replaying.
+func newSpool(dir string, cluster string, maxBytes int64) (*spool, error) {
+	if maxBytes <= 0 {
+		maxBytes = defaultSpoolMaxBytes
+	}
+
+	if err := os.MkdirAll(dir, 0755); nil != err {
+		return nil, err
+	}
+
+	s := &spool{path: filepath.Join(dir, cluster+".ndjson"), maxBytes: maxBytes}
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if nil != err {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), int(maxBytes))
+	for scanner.Scan() {
+		s.size += int64(len(scanner.Bytes())) + 1
+		s.count++
+	}
+
+	return s, scanner.Err()
+}
+
+// write appends request to the spool, fails when spool is full.
+func (s *spool) write(req *Request) error {
+	line, err := json.Marshal(req)
+	if nil != err {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+int64(len(line))+1 > s.maxBytes {
+		return fmt.Errorf("spool %s is full", s.path)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if nil != err {
+		return err
+	}
+
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); nil != err {
+		return err
+	}
+
+	s.size += int64(len(line)) + 1
+	s.count++
+
+	return nil
+}
+
+func (s *spool) len() int {
+	if nil == s {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.count
+}
+
+// replay calls fn with spooled requests in order, then empties the spool.
+func (s *spool) replay(fn func(req *Request)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if 0 == s.count {
+		return nil
+	}
+
+	file, err := os.Open(s.path)
+	if nil != err {
+		return err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), int(s.maxBytes))
+	for scanner.Scan() {
+		req := &Request{}
+		if err := json.Unmarshal(scanner.Bytes(), req); nil != err {
+			// e.g. last line is incomplete after crash.
+			logrus.WithError(err).WithField("spool", s.path).Errorln("invalid spooled request")
+			continue
+		}
+
+		fn(req)
+	}
+
+	if err := scanner.Err(); nil != err {
+		return err
+	}
+
+	s.size, s.count = 0, 0
+
+	return os.Remove(s.path)
+}
@@ -0,0 +1,50 @@
+package redes_writer
+
+import (
+	"sync"
+)
+
+// Counters are es-writer's own statistics, reported on the admin server next
+// to the statistics of the bulk processor.
+type Counters struct {
+	mu     sync.RWMutex
+	values map[string]int64
+}
+
+var defaultCounters = NewCounters()
+
+func NewCounters() *Counters {
+	return &Counters{values: map[string]int64{}}
+}
+
+// DefaultCounters returns the counters used by NewProcessor, Engine has its own.
+func DefaultCounters() *Counters {
+	return defaultCounters
+}
+
+func (c *Counters) Add(name string, delta int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[name] += delta
+}
+
+func (c *Counters) Get(name string) int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.values[name]
+}
+
+// Snapshot returns a copy of all counters, safe to be serialized.
+func (c *Counters) Snapshot() map[string]int64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	values := make(map[string]int64, len(c.values))
+	for name, value := range c.values {
+		values[name] = value
+	}
+
+	return values
+}
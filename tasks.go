@@ -0,0 +1,290 @@
+package redes_writer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// how often status of running tasks is checked.
+	taskPollInterval = 5 * time.Second
+
+	// number of tasks kept for statistics, oldest completed tasks are dropped.
+	maxTrackedTasks = 100
+)
+
+// types of requests which are executed as Elastic Search tasks.
+var byQueryRequestTypes = []string{"update_by_query", "delete_by_query"}
+
+func (r Request) isByQuery() bool {
+	return contains(byQueryRequestTypes, r.Type)
+}
+
+// Task is update_by_query or delete_by_query request running on Elastic Search.
+type Task struct {
+	Cluster   string      `json:"cluster"`
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	Index     string      `json:"index"`
+	StartedAt time.Time   `json:"startedAt"`
+	Completed bool        `json:"completed"`
+	Status    interface{} `json:"status,omitempty"` // progress, as reported by Elastic Search
+	Failures  int         `json:"failures,omitempty"`
+	Error     string      `json:"error,omitempty"`
+}
+
+// taskResult is status of a task, with the response of completed tasks.
+type taskResult struct {
+	Completed bool `json:"completed"`
+	Task      struct {
+		Status interface{} `json:"status"`
+	} `json:"task"`
+	Error    *elastic.ErrorDetails `json:"error"`
+	Response *struct {
+		TimedOut bool              `json:"timed_out"`
+		Canceled string            `json:"canceled"`
+		Failures []json.RawMessage `json:"failures"`
+	} `json:"response"`
+}
+
+// taskTracker starts by-query tasks on a cluster and follows their status.
+type taskTracker struct {
+	mu       sync.Mutex
+	cluster  string
+	client   *elastic.Client
+	counters *Counters
+	report   func(err error) // optional, failed tasks
+	tasks    []*Task
+}
+
+func newTaskTracker(cluster string, client *elastic.Client, counters *Counters, report func(err error)) *taskTracker {
+	return &taskTracker{
+		cluster:  cluster,
+		client:   client,
+		counters: counters,
+		report:   report,
+	}
+}
+
+func (t *taskTracker) start(ctx context.Context, req *Request) error {
+	byQuery := req.UpdateByQuery
+	if "delete_by_query" == req.Type {
+		byQuery = req.DeleteByQuery
+	}
+
+	if nil == byQuery.Query {
+		return fmt.Errorf("%s: missing query", req.Type)
+	}
+
+	query, err := json.Marshal(byQuery.Query)
+	if nil != err {
+		return err
+	}
+
+	var res *elastic.StartTaskResult
+	if "update_by_query" == req.Type {
+		service := t.client.UpdateByQuery(byQuery.Index).Query(elastic.NewRawStringQuery(string(query)))
+		if nil != byQuery.Script {
+			service.Script(byQuery.Script.toElastic())
+		}
+
+		if "" != byQuery.Conflicts {
+			service.Conflicts(byQuery.Conflicts)
+		}
+
+		if nil != byQuery.Slices {
+			service.Slices(byQuery.Slices)
+		}
+
+		if "" != byQuery.Routing {
+			service.Routing(byQuery.Routing)
+		}
+
+		res, err = service.DoAsync(ctx)
+	} else {
+		service := t.client.DeleteByQuery(byQuery.Index).Query(elastic.NewRawStringQuery(string(query)))
+		if "" != byQuery.Conflicts {
+			service.Conflicts(byQuery.Conflicts)
+		}
+
+		if nil != byQuery.Slices {
+			service.Slices(byQuery.Slices)
+		}
+
+		if "" != byQuery.Routing {
+			service.Routing(byQuery.Routing)
+		}
+
+		res, err = service.DoAsync(ctx)
+	}
+
+	if nil != err {
+		t.counters.Add("cluster."+t.cluster+".tasks.failed", 1)
+
+		return err
+	}
+
+	t.add(&Task{
+		Cluster:   t.cluster,
+		Id:        res.TaskId,
+		Type:      req.Type,
+		Index:     byQuery.Index,
+		StartedAt: time.Now(),
+	})
+
+	logrus.
+		WithField("cluster", t.cluster).
+		WithField("type", req.Type).
+		WithField("task", res.TaskId).
+		Infoln("task started")
+
+	return nil
+}
+
+func (t *taskTracker) add(task *Task) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.tasks = append(t.tasks, task)
+	t.counters.Add("cluster."+t.cluster+".tasks.started", 1)
+
+	// drop oldest completed tasks.
+	for i := 0; len(t.tasks) > maxTrackedTasks && i < len(t.tasks); {
+		if t.tasks[i].Completed {
+			t.tasks = append(t.tasks[:i], t.tasks[i+1:]...)
+		} else {
+			i++
+		}
+	}
+}
+
+// run checks status of running tasks, until ctx is cancelled.
+func (t *taskTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(taskPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			t.poll(ctx)
+		}
+	}
+}
+
+func (t *taskTracker) poll(ctx context.Context) {
+	for _, task := range t.running() {
+		result, err := t.getTask(ctx, task.Id)
+
+		t.mu.Lock()
+		switch {
+		case elastic.IsNotFound(err):
+			task.Completed = true
+			task.Error = "task not found"
+
+		case nil != err:
+			task.Error = err.Error()
+
+		default:
+			task.Error = ""
+			task.Completed = result.Completed
+			task.Status = result.Task.Status
+			if task.Completed {
+				task.Error, task.Failures = result.failure()
+			}
+		}
+
+		failed := task.Completed && "" != task.Error
+		if failed {
+			t.counters.Add("cluster."+t.cluster+".tasks.failed", 1)
+		} else if task.Completed {
+			t.counters.Add("cluster."+t.cluster+".tasks.completed", 1)
+		}
+
+		taskErr := &TaskError{Cluster: t.cluster, Id: task.Id, Type: task.Type, Index: task.Index, Failures: task.Failures, Reason: task.Error}
+		t.mu.Unlock()
+
+		if failed && nil != t.report {
+			t.report(taskErr)
+		}
+	}
+}
+
+// getTask reads status of task, including its response which is not part of
+// elastic.TasksGetTaskResponse.
+func (t *taskTracker) getTask(ctx context.Context, id string) (*taskResult, error) {
+	res, err := t.client.PerformRequest(ctx, elastic.PerformRequestOptions{
+		Method: "GET",
+		Path:   "/_tasks/" + url.PathEscape(id),
+	})
+
+	if nil != err {
+		return nil, err
+	}
+
+	result := &taskResult{}
+	if err := json.Unmarshal(res.Body, result); nil != err {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// failure returns why completed task failed, empty when it succeeded, with
+// number of documents which failed.
+func (r *taskResult) failure() (string, int) {
+	switch {
+	case nil != r.Error:
+		return fmt.Sprintf("%s: %s", r.Error.Type, r.Error.Reason), 0
+
+	case nil == r.Response:
+		return "", 0
+
+	case len(r.Response.Failures) > 0:
+		return fmt.Sprintf("%d document(s) failed, first: %s", len(r.Response.Failures), r.Response.Failures[0]), len(r.Response.Failures)
+
+	case "" != r.Response.Canceled:
+		return "canceled: " + r.Response.Canceled, 0
+
+	case r.Response.TimedOut:
+		return "timed out", 0
+	}
+
+	return "", 0
+}
+
+func (t *taskTracker) running() []*Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	running := []*Task{}
+	for _, task := range t.tasks {
+		if !task.Completed {
+			running = append(running, task)
+		}
+	}
+
+	return running
+}
+
+// list returns copy of tracked tasks.
+func (t *taskTracker) list() []Task {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tasks := make([]Task, len(t.tasks))
+	for i, task := range t.tasks {
+		tasks[i] = *task
+	}
+
+	return tasks
+}
@@ -0,0 +1,112 @@
+package redes_writer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/olivere/elastic/v7"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTaskTracker(t *testing.T) {
+	tasks := map[string]string{
+		"node:1": `{"completed": false, "task": {"status": {"total": 10, "deleted": 2}}}`,
+		"node:2": `{"completed": true, "task": {"status": {"total": 10, "deleted": 9}}, "response": {"failures": [{"index": "tmp-1", "id": "3", "cause": {"type": "version_conflict_engine_exception"}}]}}`,
+		"node:3": `{"completed": true, "task": {"status": {"total": 10, "updated": 10}}, "response": {"failures": []}}`,
+	}
+
+	started := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_delete_by_query"), strings.HasSuffix(r.URL.Path, "/_update_by_query"):
+			started++
+			_, _ = fmt.Fprintf(w, `{"task": "node:%d"}`, started)
+
+		case strings.HasPrefix(r.URL.Path, "/_tasks/"):
+			body, ok := tasks[strings.TrimPrefix(r.URL.Path, "/_tasks/")]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = fmt.Fprint(w, `{"error": {"type": "resource_not_found_exception", "reason": "task not found"}, "status": 404}`)
+
+				return
+			}
+
+			_, _ = fmt.Fprint(w, body)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	defer server.Close()
+
+	client, err := elastic.NewClient(elastic.SetURL(server.URL), elastic.SetSniff(false), elastic.SetHealthcheck(false))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	counters := NewCounters()
+	reported := []error{}
+	tracker := newTaskTracker("default", client, counters, func(err error) { reported = append(reported, err) })
+
+	ctx := context.Background()
+	for _, raw := range []string{
+		`{"type": "delete_by_query", "delete_by_query": {"index": "tmp-1", "query": {"match_all": {}}}}`,
+		`{"type": "delete_by_query", "delete_by_query": {"index": "tmp-1", "query": {"match_all": {}}}}`,
+		`{"type": "update_by_query", "update_by_query": {"index": "lr", "query": {"match_all": {}}}}`,
+		`{"type": "update_by_query", "update_by_query": {"index": "lr", "query": {"match_all": {}}}}`,
+	} {
+		req, _ := fromBytes(raw)
+		assert.NoError(t, tracker.start(ctx, req))
+	}
+
+	assert.Equal(t, int64(4), counters.Get("cluster.default.tasks.started"))
+	assert.Len(t, tracker.running(), 4)
+
+	tracker.poll(ctx)
+	list := tracker.list()
+	assert.False(t, list[0].Completed, "running task")
+	assert.Equal(t, map[string]interface{}{"total": float64(10), "deleted": float64(2)}, list[0].Status)
+
+	assert.True(t, list[1].Completed, "task with failures")
+	assert.Equal(t, 1, list[1].Failures)
+	assert.Contains(t, list[1].Error, "1 document(s) failed")
+
+	assert.True(t, list[2].Completed, "successful task")
+	assert.Empty(t, list[2].Error)
+
+	assert.True(t, list[3].Completed, "unknown task")
+	assert.Equal(t, "task not found", list[3].Error)
+
+	assert.Equal(t, int64(1), counters.Get("cluster.default.tasks.completed"))
+	assert.Equal(t, int64(2), counters.Get("cluster.default.tasks.failed"))
+	assert.Len(t, tracker.running(), 1)
+
+	// failed tasks are reported.
+	if assert.Len(t, reported, 2) {
+		taskErr, ok := reported[0].(*TaskError)
+		assert.True(t, ok)
+		assert.Equal(t, "node:2", taskErr.Id)
+		assert.Equal(t, "delete_by_query", taskErr.Type)
+		assert.Equal(t, SeverityError, taskErr.Severity())
+	}
+}
+
+func TestTaskTracker_Add(t *testing.T) {
+	tracker := newTaskTracker("default", nil, NewCounters(), nil)
+	tracker.add(&Task{Id: "running"})
+	for i := 0; i < maxTrackedTasks; i++ {
+		tracker.add(&Task{Id: fmt.Sprint(i), Completed: true})
+	}
+
+	// oldest completed task is dropped, running tasks are kept.
+	list := tracker.list()
+	assert.Len(t, list, maxTrackedTasks)
+	assert.Equal(t, "running", list[0].Id)
+	assert.Equal(t, "1", list[1].Id)
+}
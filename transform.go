@@ -0,0 +1,269 @@
+package redes_writer
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"strconv"
+	"time"
+)
+
+type (
+	// transform modifies a document in place.
+	transform func(doc map[string]interface{}) error
+
+	// transformer applies transforms declared for index patterns to documents
+	// of index & update requests, before writing.
+	transformer struct {
+		rules []transformRule
+	}
+
+	transformRule struct {
+		index      string
+		transforms []transform
+	}
+)
+
+func newTransformer(configs []TransformConfig) (*transformer, error) {
+	t := &transformer{}
+	for i, cnf := range configs {
+		rule := transformRule{index: cnf.Index}
+		for j, step := range cnf.Steps {
+			fn, err := newTransform(step, time.Now)
+			if nil != err {
+				return nil, fmt.Errorf("transforms[%d].steps[%d]: %s", i, j, err)
+			}
+
+			rule.transforms = append(rule.transforms, fn)
+		}
+
+		t.rules = append(t.rules, rule)
+	}
+
+	return t, nil
+}
+
+// wrap returns a writer which transforms documents before writing.
+func (t *transformer) wrap(writer Writer) Writer {
+	return func(req *Request) error {
+		if nil != req {
+			if err := t.apply(req); nil != err {
+				return reject(err)
+			}
+		}
+
+		return writer(req)
+	}
+}
+
+func (t *transformer) apply(req *Request) error {
+	var doc interface{}
+	switch req.Type {
+	case "index":
+		doc = req.Index.Doc
+
+	case "update":
+		doc = req.Update.Doc
+	}
+
+	object, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	for _, rule := range t.rules {
+		if !matchIndex(rule.index, req.indexName()) {
+			continue
+		}
+
+		for _, fn := range rule.transforms {
+			if err := fn(object); nil != err {
+				return fmt.Errorf("failed to transform document of %s: %s", req.indexName(), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newTransform builds transform from its declaration, now is used by timestamp.
+func newTransform(step TransformStep, now func() time.Time) (transform, error) {
+	if "" == step.Field {
+		return nil, fmt.Errorf("missing field of %s", step.Op)
+	}
+
+	switch step.Op {
+	case "set":
+		return func(doc map[string]interface{}) error {
+			// normalized on each call, documents must not share objects.
+			return setField(doc, step.Field, normalizeYaml(step.Value))
+		}, nil
+
+	case "remove":
+		return func(doc map[string]interface{}) error {
+			deleteField(doc, step.Field)
+
+			return nil
+		}, nil
+
+	case "rename", "copy":
+		if "" == step.To {
+			return nil, fmt.Errorf("missing destination field of %s", step.Op)
+		}
+
+		return func(doc map[string]interface{}) error {
+			value, ok := getField(doc, step.Field)
+			if !ok {
+				return nil
+			}
+
+			if "rename" == step.Op {
+				deleteField(doc, step.Field)
+			}
+
+			return setField(doc, step.To, value)
+		}, nil
+
+	case "convert":
+		if _, err := convert(nil, step.Type); nil != err {
+			return nil, err
+		}
+
+		return func(doc map[string]interface{}) error {
+			value, ok := getField(doc, step.Field)
+			if !ok || nil == value {
+				return nil
+			}
+
+			converted, err := convert(value, step.Type)
+			if nil != err {
+				return fmt.Errorf("%s: %s", step.Field, err)
+			}
+
+			return setField(doc, step.Field, converted)
+		}, nil
+
+	case "timestamp":
+		format := step.Format
+		if "" == format {
+			format = time.RFC3339
+		}
+
+		return func(doc map[string]interface{}) error {
+			return setField(doc, step.Field, now().UTC().Format(format))
+		}, nil
+
+	case "hash":
+		newHash, err := hashFunc(step.Algorithm)
+		if nil != err {
+			return nil, err
+		}
+
+		to := step.To
+		if "" == to {
+			to = step.Field
+		}
+
+		return func(doc map[string]interface{}) error {
+			value, ok := getField(doc, step.Field)
+			if !ok || nil == value {
+				return nil
+			}
+
+			h := newHash()
+			_, _ = h.Write([]byte(fmt.Sprint(value)))
+
+			return setField(doc, to, hex.EncodeToString(h.Sum(nil)))
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown transform %q", step.Op)
+}
+
+// convert converts value decoded from JSON to int, float, string or bool.
+// nil value is used to validate the type.
+func convert(value interface{}, typ string) (interface{}, error) {
+	switch typ {
+	case "int", "float", "string", "bool":
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+
+	if nil == value {
+		return nil, nil
+	}
+
+	switch typ {
+	case "string":
+		if f, ok := value.(float64); ok {
+			return strconv.FormatFloat(f, 'f', -1, 64), nil
+		}
+
+		return fmt.Sprint(value), nil
+
+	case "int", "float":
+		var f float64
+		switch v := value.(type) {
+		case float64:
+			f = v
+
+		case bool:
+			if v {
+				f = 1
+			}
+
+		case string:
+			var err error
+			f, err = strconv.ParseFloat(v, 64)
+			if nil != err {
+				return nil, fmt.Errorf("can not convert %q to %s", v, typ)
+			}
+
+		default:
+			return nil, fmt.Errorf("can not convert %v to %s", value, typ)
+		}
+
+		if "int" == typ {
+			return int64(f), nil
+		}
+
+		return f, nil
+
+	default: // bool
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+
+		case float64:
+			return 0 != v, nil
+
+		case string:
+			b, err := strconv.ParseBool(v)
+			if nil != err {
+				return nil, fmt.Errorf("can not convert %q to bool", v)
+			}
+
+			return b, nil
+		}
+
+		return nil, fmt.Errorf("can not convert %v to bool", value)
+	}
+}
+
+func hashFunc(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "", "sha256":
+		return sha256.New, nil
+
+	case "sha1":
+		return sha1.New, nil
+
+	case "md5":
+		return md5.New, nil
+	}
+
+	return nil, fmt.Errorf("unknown hash algorithm %q", algorithm)
+}
@@ -0,0 +1,108 @@
+package redes_writer
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNewTransform(t *testing.T) {
+	now := func() time.Time { return time.Date(2026, 10, 18, 10, 0, 0, 0, time.UTC) }
+
+	cases := []struct {
+		step     string
+		doc      string
+		expected string
+	}{
+		{`{op: set, field: meta.source, value: {name: es-writer}}`, `{}`, `{"meta":{"source":{"name":"es-writer"}}}`},
+		{`{op: rename, field: user.mail, to: user.email}`, `{"user":{"mail":"a@b.c"}}`, `{"user":{"email":"a@b.c"}}`},
+		{`{op: rename, field: missing, to: other}`, `{"a":1}`, `{"a":1}`},
+		{`{op: copy, field: title, to: title_raw}`, `{"title":"Go"}`, `{"title":"Go","title_raw":"Go"}`},
+		{`{op: remove, field: user.password}`, `{"user":{"name":"a","password":"b"}}`, `{"user":{"name":"a"}}`},
+		{`{op: convert, field: age, type: int}`, `{"age":"42"}`, `{"age":42}`},
+		{`{op: convert, field: score, type: float}`, `{"score":"4.5"}`, `{"score":4.5}`},
+		{`{op: convert, field: id, type: string}`, `{"id":123}`, `{"id":"123"}`},
+		{`{op: convert, field: active, type: bool}`, `{"active":"true"}`, `{"active":true}`},
+		{`{op: timestamp, field: indexed_at}`, `{}`, `{"indexed_at":"2026-10-18T10:00:00Z"}`},
+		{`{op: hash, field: email, to: email_hash, algorithm: md5}`, `{"email":"a@b.c"}`, `{"email":"a@b.c","email_hash":"5d60d4e28066df254d5452f92c910092"}`},
+	}
+
+	for _, c := range cases {
+		var step TransformStep
+		if err := yaml.Unmarshal([]byte(c.step), &step); nil != err {
+			t.Error(err)
+			t.FailNow()
+		}
+
+		fn, err := newTransform(step, now)
+		if nil != err {
+			t.Error(c.step, err)
+			continue
+		}
+
+		doc := map[string]interface{}{}
+		_ = json.Unmarshal([]byte(c.doc), &doc)
+		assert.NoError(t, fn(doc), c.step)
+
+		actual, _ := json.Marshal(doc)
+		assert.Equal(t, c.expected, string(actual), c.step)
+	}
+}
+
+func TestNewTransform_Invalid(t *testing.T) {
+	for _, step := range []TransformStep{
+		{Op: "set"},
+		{Op: "unknown", Field: "a"},
+		{Op: "rename", Field: "a"},
+		{Op: "convert", Field: "a", Type: "date"},
+		{Op: "hash", Field: "a", Algorithm: "crc32"},
+	} {
+		_, err := newTransform(step, time.Now)
+		assert.Error(t, err, step.Op)
+	}
+
+	fn, _ := newTransform(TransformStep{Op: "convert", Field: "age", Type: "int"}, time.Now)
+	assert.Error(t, fn(map[string]interface{}{"age": "forty-two"}))
+}
+
+func TestTransformer(t *testing.T) {
+	tr, err := newTransformer([]TransformConfig{
+		{Index: "lr*", Steps: []TransformStep{{Op: "remove", Field: "secret"}}},
+		{Index: "audit", Steps: []TransformStep{{Op: "set", Field: "audited", Value: true}}},
+	})
+
+	if nil != err {
+		t.Error(err)
+		t.FailNow()
+	}
+
+	req, _ := fromBytes(`{"type": "update", "update": {"index": "lr-2", "id": "1", "doc": {"secret": "s", "field": "v"}}}`)
+	assert.NoError(t, tr.apply(req))
+	assert.Equal(t, map[string]interface{}{"field": "v"}, req.Update.Doc)
+}
+
+func TestTransformer_Wrap(t *testing.T) {
+	tr, _ := newTransformer([]TransformConfig{
+		{Index: "lr", Steps: []TransformStep{{Op: "convert", Field: "age", Type: "int"}}},
+	})
+
+	written := 0
+	writer := tr.wrap(func(req *Request) error {
+		written++
+
+		return nil
+	})
+
+	req, _ := fromBytes(`{"type": "index", "index": {"index": "lr", "id": "1", "doc": {"age": "42"}}}`)
+	assert.NoError(t, writer(req))
+
+	// message is moved to the rejection queue, not lost.
+	req, _ = fromBytes(`{"type": "index", "index": {"index": "lr", "id": "2", "doc": {"age": "old"}}}`)
+	err := writer(req)
+	assert.IsType(t, &ValidationError{}, err)
+	assert.Contains(t, err.Error(), "failed to transform document of lr")
+	assert.Equal(t, 1, written)
+}
@@ -62,3 +62,13 @@ func readTimeout(source chan string) string {
 		return ""
 	}
 }
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}